@@ -22,6 +22,7 @@ import (
 	xormadapter "github.com/casbin/xorm-adapter"
 	"log"
 	"strings"
+	"sync"
 
 	"github.com/casbin/casbin"
 	"github.com/devtron-labs/devtron/pkg/sql"
@@ -30,6 +31,7 @@ import (
 
 var e *casbin.Enforcer
 var enforcerImplRef *EnforcerImpl
+var enforcerImplRefMutex sync.RWMutex
 
 type Subject string
 type Resource string
@@ -66,17 +68,55 @@ func Create() *casbin.Enforcer {
 		log.Fatal(err)
 	}
 	//adding our key matching func - MatchKeyFunc, to enforcer
-	e.AddFunction("matchKeyByPart", MatchKeyByPartFunc)
+	addMatcherFunctions(e)
 	return e
 }
 
-func setEnforcerImpl(ref *EnforcerImpl) {
+// SetGlobalEnforcerImpl registers ref as the enforcer whose cache is invalidated by the package level policy
+// functions, e.g. AddPolicy. NewEnforcerImpl registers the enforcer wrapping the one created by Create on its own,
+// enforcers over other casbin enforcers stay independent unless registered here
+func SetGlobalEnforcerImpl(ref *EnforcerImpl) {
+	enforcerImplRefMutex.Lock()
+	defer enforcerImplRefMutex.Unlock()
 	enforcerImplRef = ref
 }
 
+// GlobalEnforcerImpl returns the enforcer registered through SetGlobalEnforcerImpl, nil if there is none
+func GlobalEnforcerImpl() *EnforcerImpl {
+	enforcerImplRefMutex.RLock()
+	defer enforcerImplRefMutex.RUnlock()
+	return enforcerImplRef
+}
+
+func invalidateGlobalCache(emailId string) {
+	if ref := GlobalEnforcerImpl(); ref != nil {
+		ref.InvalidateCache(emailId)
+	}
+}
+
+// invalidateGlobalSubjects drops the cache entries of subjects, a "*" subject's policies apply to every subject
+// so it drops the complete cache
+func invalidateGlobalSubjects(subjects []string) {
+	for _, subject := range subjects {
+		if subject == "*" {
+			invalidateGlobalCompleteCache()
+			return
+		}
+	}
+	for _, subject := range subjects {
+		invalidateGlobalCache(subject)
+	}
+}
+
+func invalidateGlobalCompleteCache() {
+	if ref := GlobalEnforcerImpl(); ref != nil {
+		ref.InvalidateCompleteCache()
+	}
+}
+
 func AddPolicy(policies []Policy) []Policy {
 	defer handlePanic()
-	LoadPolicy()
+	syncPolicy()
 	var failed = []Policy{}
 	var emailIdList []string
 	for _, p := range policies {
@@ -107,20 +147,36 @@ func AddPolicy(policies []Policy) []Policy {
 			fmt.Println("policy reloaded successfully")
 		}
 	}
-	for _, emailId := range emailIdList {
-		enforcerImplRef.InvalidateCache(emailId)
-	}
+	invalidateGlobalSubjects(emailIdList)
 	return failed
 }
 
+// LoadPolicy reloads the policies from the database, e.g. after they were changed by another instance, and starts a
+// new policy generation of the registered enforcer so that every cached decision is evaluated again
 func LoadPolicy() {
+	defer handlePanic()
+	if syncPolicy() {
+		if ref := GlobalEnforcerImpl(); ref != nil {
+			ref.bumpPolicyGeneration()
+		}
+	}
+}
+
+// syncPolicy reloads the policies from the database without starting a new policy generation, for AddPolicy to edit
+// the latest policies. AddPolicy invalidates only the subjects it edits, decisions of other subjects changed in the
+// database meanwhile stay cached until LoadPolicy or the invalidation events of the instance which changed them
+func syncPolicy() (loaded bool) {
 	defer handlePanic()
 	err := e.LoadPolicy()
 	if err != nil {
 		fmt.Println("error in reloading policies", err)
-	} else {
-		fmt.Println("policy reloaded successfully")
+		return false
 	}
+	fmt.Println("policy reloaded successfully")
+	if ref := GlobalEnforcerImpl(); ref != nil {
+		ref.MarkPolicyLoaded()
+	}
+	return true
 }
 
 func RemovePolicy(policies []Policy) []Policy {
@@ -144,9 +200,7 @@ func RemovePolicy(policies []Policy) []Policy {
 	if len(policies) != len(failed) {
 		_ = e.LoadPolicy()
 	}
-	for _, emailId := range emailIdList {
-		enforcerImplRef.InvalidateCache(emailId)
-	}
+	invalidateGlobalSubjects(emailIdList)
 	return failed
 }
 
@@ -156,7 +210,7 @@ func GetAllSubjects() []string {
 
 func DeleteRoleForUser(user string, role string) bool {
 	user = strings.ToLower(user)
-	enforcerImplRef.InvalidateCache(user)
+	invalidateGlobalCache(user)
 	return e.DeleteRoleForUser(user, role)
 }
 
@@ -171,7 +225,7 @@ func GetUserByRole(role string) ([]string, error) {
 }
 
 func RemovePoliciesByRoles(roles string) bool {
-	enforcerImplRef.InvalidateCompleteCache()
+	invalidateGlobalCompleteCache()
 	roles = strings.ToLower(roles)
 	return e.RemovePolicy([]string{roles})
 }
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"go/token"
+	"reflect"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// EnforceWithAttributes enforces the token's subject against an attribute based model, whose request is
+// r = sub, obj. attrs are passed as r.obj and are accessed as its fields in matchers, e.g. r.obj.Owner == r.sub,
+// so attribute names have to be exported Go identifiers. Decisions are not cached as they depend on attrs
+func (e *EnforcerImpl) EnforceWithAttributes(token string, attrs map[string]interface{}) (bool, error) {
+	mapClaims, err := e.verifyToken(token)
+	if err != nil {
+		return false, unauthenticatedErr(err)
+	}
+	obj, err := toAttributeObject(attrs)
+	if err != nil {
+		return false, err
+	}
+	email := e.resolveSubject(mapClaims)
+	if email == "" {
+		return false, nil
+	}
+	if allowed, decided := e.principalDecision(email); decided {
+		return allowed, nil
+	}
+	return e.enforcePolicy(e.Enforcer, email, obj)
+}
+
+// toAttributeObject builds a struct value holding attrs as fields, matchers can only access struct fields
+func toAttributeObject(attrs map[string]interface{}) (interface{}, error) {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		if !token.IsIdentifier(name) || !token.IsExported(name) {
+			return nil, status.Errorf(codes.InvalidArgument, "attribute %q is not an exported identifier", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]reflect.StructField, len(names))
+	for i, name := range names {
+		fields[i] = reflect.StructField{Name: name, Type: reflect.TypeOf((*interface{})(nil)).Elem()}
+	}
+	obj := reflect.New(reflect.StructOf(fields)).Elem()
+	for i, name := range names {
+		if value := attrs[name]; value != nil {
+			obj.Field(i).Set(reflect.ValueOf(value))
+		}
+	}
+	return obj.Interface(), nil
+}
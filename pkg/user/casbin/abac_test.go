@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"testing"
+
+	"github.com/casbin/casbin"
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const abacModel = `
+[request_definition]
+r = sub, obj
+
+[policy_definition]
+p = sub, eft
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.obj.Owner == r.sub || (r.obj.Visibility == "public" && p.sub == "*")
+`
+
+func TestEnforceWithAttributes(t *testing.T) {
+	enf := casbin.NewEnforcer(casbin.NewModel(abacModel), false)
+	enf.AddPolicy("*", "allow")
+	enforcer := newTestEnforcerFor(t, false, enf)
+	token := newTestToken(t, jwt.MapClaims{"email": "User@example.com"})
+
+	tests := []struct {
+		name    string
+		attrs   map[string]interface{}
+		want    bool
+		wantErr codes.Code
+	}{
+		{name: "owner", attrs: map[string]interface{}{"Owner": "user@example.com", "Visibility": "private"}, want: true},
+		{name: "other owner", attrs: map[string]interface{}{"Owner": "other@example.com", "Visibility": "private"}, want: false},
+		{name: "public object", attrs: map[string]interface{}{"Owner": "other@example.com", "Visibility": "public"}, want: true},
+		{name: "unexported attribute", attrs: map[string]interface{}{"owner": "user@example.com"}, wantErr: codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := enforcer.EnforceWithAttributes(token, tt.attrs)
+			if status.Code(err) != tt.wantErr || got != tt.want {
+				t.Errorf("EnforceWithAttributes(%v) = %v, %v, want %v, %v", tt.attrs, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+	if _, err := enforcer.EnforceWithAttributes("not-a-token", map[string]interface{}{"Owner": "user@example.com"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("EnforceWithAttributes of invalid token = %v, want %v", err, codes.Unauthenticated)
+	}
+}
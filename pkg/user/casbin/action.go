@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// actionInheritance holds, for every fine grained action, the coarse grained actions whose grants imply it
+type actionInheritance struct {
+	mutex     sync.RWMutex
+	impliedBy map[string][]string
+}
+
+// SetActionInheritance replaces the action hierarchy, inheritance maps a coarse grained action to the actions it
+// encompasses, e.g. manage to view, edit and delete. It is transitive, so a grant of manage also satisfies the
+// actions encompassed by edit
+func (e *EnforcerImpl) SetActionInheritance(inheritance map[string][]string) {
+	impliedBy := make(map[string][]string)
+	for action := range inheritance {
+		for implied := range getImpliedActions(inheritance, action) {
+			impliedBy[implied] = append(impliedBy[implied], strings.ToLower(action))
+		}
+	}
+	for action := range impliedBy {
+		sort.Strings(impliedBy[action])
+	}
+	e.actions.mutex.Lock()
+	e.actions.impliedBy = impliedBy
+	e.actions.mutex.Unlock()
+	e.InvalidateCompleteCache()
+}
+
+// getImpliedActions walks inheritance from action, returning every action it encompasses directly or through
+// another encompassed action
+func getImpliedActions(inheritance map[string][]string, action string) map[string]bool {
+	implied := make(map[string]bool)
+	pending := append([]string{}, inheritance[action]...)
+	for len(pending) > 0 {
+		next := pending[0]
+		pending = pending[1:]
+		if implied[strings.ToLower(next)] || next == action {
+			continue
+		}
+		implied[strings.ToLower(next)] = true
+		pending = append(pending, inheritance[next]...)
+	}
+	return implied
+}
+
+// grantingActions returns the coarse grained actions whose grants satisfy action
+func (e *EnforcerImpl) grantingActions(action string) []string {
+	e.actions.mutex.RLock()
+	defer e.actions.mutex.RUnlock()
+	return e.actions.impliedBy[strings.ToLower(action)]
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestActionInheritance(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, [][]string{
+		{"user@example.com", "applications", "manage", "team1/*", "allow"},
+	}, nil)
+	vals := []string{"team1/app1", "team2/app1"}
+	if result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "view", vals); result["team1/app1"] {
+		t.Fatalf("view allowed without an action hierarchy")
+	}
+
+	enforcer.SetActionInheritance(map[string][]string{
+		"manage": {"edit", "delete"},
+		"edit":   {"view"},
+	})
+	tests := []struct {
+		action string
+		want   map[string]bool
+	}{
+		{action: "manage", want: map[string]bool{"team1/app1": true, "team2/app1": false}},
+		{action: "edit", want: map[string]bool{"team1/app1": true, "team2/app1": false}},
+		{action: "view", want: map[string]bool{"team1/app1": true, "team2/app1": false}},
+		{action: "trigger", want: map[string]bool{"team1/app1": false, "team2/app1": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			if got := enforcer.EnforceByEmailInBatch("user@example.com", "applications", tt.action, vals); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EnforceByEmailInBatch(%s) = %v, want %v", tt.action, got, tt.want)
+			}
+		})
+	}
+	if !enforcer.EnforceByEmail("user@example.com", "applications", "view", "team1/app1") {
+		t.Errorf("EnforceByEmail of view not satisfied by the manage grant")
+	}
+
+	enforcer.AddDenyPolicy("user@example.com", "applications", "delete", "team1/app1")
+	if enforcer.EnforceByEmail("user@example.com", "applications", "delete", "team1/app1") {
+		t.Errorf("EnforceByEmail of an explicitly denied delete satisfied by the manage grant")
+	}
+	if got, want := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "delete", []string{"team1/app1", "team1/app2"}),
+		map[string]bool{"team1/app1": false, "team1/app2": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EnforceByEmailInBatch(delete) = %v, want %v", got, want)
+	}
+	if !enforcer.EnforceByEmail("user@example.com", "applications", "edit", "team1/app1") {
+		t.Errorf("EnforceByEmail of edit, not denied, no longer satisfied by the manage grant")
+	}
+}
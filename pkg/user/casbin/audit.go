@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin"
+)
+
+// auditSink writes a line per decision, "timestamp subject resource action object allow|deny", to a buffered writer
+// flushed after every decision or batch, so that lines reach the sink without callers flushing and none are lost on
+// shutdown
+type auditSink struct {
+	mutex  sync.Mutex
+	writer *bufio.Writer
+}
+
+// SetAuditSink streams decisions to writer, nil disables the audit. The lines of a decision or batch are written
+// out together, the previous sink is flushed when replaced
+func (e *EnforcerImpl) SetAuditSink(writer io.Writer) error {
+	e.audit.mutex.Lock()
+	defer e.audit.mutex.Unlock()
+	var err error
+	if e.audit.writer != nil {
+		err = e.audit.writer.Flush()
+	}
+	e.audit.writer = nil
+	if writer != nil {
+		e.audit.writer = bufio.NewWriter(writer)
+	}
+	return err
+}
+
+// FlushAudit writes out the buffered decisions of the audit sink, if any are left by a failed write
+func (e *EnforcerImpl) FlushAudit() error {
+	e.audit.mutex.Lock()
+	defer e.audit.mutex.Unlock()
+	if e.audit.writer == nil {
+		return nil
+	}
+	return e.audit.writer.Flush()
+}
+
+// auditDecision writes the decision of a single enforcement against enf, rvals being subject, resource, action and
+// object. Decisions against an enforcer other than the live one, e.g. dry runs of EnforceAgainst, are not written
+func (e *EnforcerImpl) auditDecision(enf *casbin.Enforcer, allowed bool, rvals ...interface{}) {
+	if enf != e.Enforcer {
+		return
+	}
+	e.audit.mutex.Lock()
+	defer e.audit.mutex.Unlock()
+	if e.audit.writer == nil || len(rvals) < 4 {
+		return
+	}
+	e.writeAuditLine(time.Now(), rvals[0], rvals[1], rvals[2], rvals[3], allowed)
+	e.flushAuditLines()
+}
+
+// auditBatch writes the decisions of a batch's vals, all under the same timestamp. result may hold other cached
+// objects of the resource and action, only the requested ones are written
+func (e *EnforcerImpl) auditBatch(emailId string, resource string, action string, vals []string, result map[string]bool) {
+	e.audit.mutex.Lock()
+	defer e.audit.mutex.Unlock()
+	if e.audit.writer == nil {
+		return
+	}
+	now := time.Now()
+	for _, object := range vals {
+		if allowed, found := result[object]; found {
+			e.writeAuditLine(now, emailId, resource, action, object, allowed)
+		}
+	}
+	e.flushAuditLines()
+}
+
+// flushAuditLines writes out the lines of the audit sink, the caller holds its mutex
+func (e *EnforcerImpl) flushAuditLines() {
+	if err := e.audit.writer.Flush(); err != nil {
+		e.logger.Errorw("error in flushing audit lines", "err", err)
+	}
+}
+
+func (e *EnforcerImpl) writeAuditLine(now time.Time, subject interface{}, resource interface{}, action interface{}, object interface{}, allowed bool) {
+	decision := "deny"
+	if allowed {
+		decision = "allow"
+	}
+	if _, err := fmt.Fprintf(e.audit.writer, "%s %v %v %v %v %s\n", now.UTC().Format(time.RFC3339Nano), subject, resource, action, object, decision); err != nil {
+		e.logger.Errorw("error in writing audit line", "err", err)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestAuditSink(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	buffer := &bytes.Buffer{}
+	if err := enforcer.SetAuditSink(buffer); err != nil {
+		t.Fatalf("SetAuditSink() = %v", err)
+	}
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+	enforcer.Enforce(token, "applications", "get", "team1/app1")
+	enforcer.EnforceByEmail("user@example.com", "applications", "delete", "team1/app1")
+	enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team2/app1", "team4/app1"})
+	enforcer.EnforceByEmailUntilDeny("user@example.com", "environment", "get", []string{"env1/app1"})
+	// a dry run is not a decision
+	proposed := newTestCasbinEnforcer([][]string{{"user@example.com", "applications", "get", "team4/*", "allow"}}, nil)
+	if !enforcer.EnforceAgainst(proposed, token, "applications", "get", "team4/app1") {
+		t.Errorf("EnforceAgainst() of the proposed policy denied")
+	}
+
+	// lines reach the sink without FlushAudit
+	var decisions []string
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 6 {
+			t.Fatalf("audit line %q has %d fields, want 6", line, len(fields))
+		}
+		if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+			t.Errorf("audit line %q timestamp: %v", line, err)
+		}
+		decisions = append(decisions, strings.Join(fields[1:], " "))
+	}
+	sort.Strings(decisions)
+	want := []string{
+		"user@example.com applications delete team1/app1 deny",
+		"user@example.com applications get team1/app1 allow",
+		"user@example.com applications get team2/app1 allow",
+		"user@example.com applications get team4/app1 deny",
+		"user@example.com environment get env1/app1 deny",
+	}
+	if strings.Join(decisions, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit decisions = %q, want %q", decisions, want)
+	}
+}
+
+func TestAuditSinkConcurrent(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	buffer := &bytes.Buffer{}
+	_ = enforcer.SetAuditSink(buffer)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1")
+			_ = enforcer.FlushAudit()
+		}()
+	}
+	wg.Wait()
+	if err := enforcer.SetAuditSink(nil); err != nil {
+		t.Fatalf("SetAuditSink(nil) = %v", err)
+	}
+	if lines := strings.Count(buffer.String(), "\n"); lines != 20 {
+		t.Errorf("audit lines = %d, want 20", lines)
+	}
+	enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1")
+	if lines := strings.Count(buffer.String(), "\n"); lines != 20 {
+		t.Errorf("audit lines after disabling the sink = %d, want 20", lines)
+	}
+}
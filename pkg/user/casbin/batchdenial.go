@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// deniedObjectDescription describes the errdetails.ResourceInfo details of DeniedObjectsErr
+const deniedObjectDescription = "denied"
+
+// EnforceByEmailInBatchRequireAll enforces vals as a batch which is allowed only if all of them are, returning
+// the error of DeniedObjectsErr otherwise
+func (e *EnforcerImpl) EnforceByEmailInBatchRequireAll(emailId string, resource string, action string, vals []string) error {
+	return DeniedObjectsErr(resource, action, vals, e.EnforceByEmailInBatch(emailId, resource, action, vals))
+}
+
+// DeniedObjectsErr turns the result of a batch of vals into nil when all of them are allowed, and otherwise into a
+// codes.PermissionDenied error matching ErrPermissionDenied. Each denied object is listed, in order of vals, by an
+// errdetails.ResourceInfo detail of resource, see DeniedObjects. Should the details fail to marshal, the objects
+// are only listed in the error's message
+func DeniedObjectsErr(resource string, action string, vals []string, result map[string]bool) error {
+	var denied []string
+	seen := make(map[string]bool)
+	for _, object := range vals {
+		if !result[object] && !seen[object] {
+			seen[object] = true
+			denied = append(denied, object)
+		}
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+	st := status.New(codes.PermissionDenied, fmt.Sprintf("permission denied: %s, %s: %s", resource, action, strings.Join(denied, ", ")))
+	details := make([]*errdetails.ResourceInfo, len(denied))
+	for i, object := range denied {
+		details[i] = &errdetails.ResourceInfo{ResourceType: resource, ResourceName: object, Description: deniedObjectDescription}
+	}
+	if withDetails, err := withResourceDetails(st, details); err == nil {
+		st = withDetails
+	}
+	return &permissionDeniedError{status: st}
+}
+
+func withResourceDetails(st *status.Status, details []*errdetails.ResourceInfo) (*status.Status, error) {
+	for _, detail := range details {
+		var err error
+		if st, err = st.WithDetails(detail); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// DeniedObjects returns the denied objects listed by the details of an error of DeniedObjectsErr, none for other
+// errors
+func DeniedObjects(err error) []string {
+	st, ok := status.FromError(err)
+	if !ok || err == nil {
+		return nil
+	}
+	var denied []string
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ResourceInfo); ok && info.GetDescription() == deniedObjectDescription {
+			denied = append(denied, info.GetResourceName())
+		}
+	}
+	return denied
+}
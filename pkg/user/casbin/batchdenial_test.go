@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEnforceByEmailInBatchRequireAll(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	if err := enforcer.EnforceByEmailInBatchRequireAll("user@example.com", "applications", "get", []string{"team1/app1", "team2/app1"}); err != nil {
+		t.Errorf("EnforceByEmailInBatchRequireAll() of allowed objects = %v", err)
+	}
+
+	vals := []string{"team9/app1", "team1/app1", "team4/app1", "team9/app1"}
+	err := enforcer.EnforceByEmailInBatchRequireAll("user@example.com", "applications", "get", vals)
+	if status.Code(err) != codes.PermissionDenied || !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("EnforceByEmailInBatchRequireAll() = %v, want permission denied", err)
+	}
+	if got, want := DeniedObjects(err), []string{"team9/app1", "team4/app1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DeniedObjects() = %v, want %v", got, want)
+	}
+	st, _ := status.FromError(err)
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ResourceInfo); !ok || info.GetResourceType() != "applications" {
+			t.Errorf("detail = %v, want resource info of applications", detail)
+		}
+	}
+}
+
+func TestDeniedObjects(t *testing.T) {
+	if got := DeniedObjects(nil); got != nil {
+		t.Errorf("DeniedObjects(nil) = %v", got)
+	}
+	if got := DeniedObjects(status.Error(codes.PermissionDenied, "permission denied")); got != nil {
+		t.Errorf("DeniedObjects() of an error without details = %v", got)
+	}
+	if got := DeniedObjects(errors.New("permission denied")); got != nil {
+		t.Errorf("DeniedObjects() of a non status error = %v", got)
+	}
+	result := map[string]bool{"a": true, "b": false}
+	if got := DeniedObjects(DeniedObjectsErr("applications", "get", []string{"a", "b", "c"}, result)); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("DeniedObjects() = %v, want objects denied and missing from the result", got)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"context"
+	"math/bits"
+)
+
+// bitsChunkSize bounds the objects EnforceByEmailBatchBits evaluates per batch, and so the size of the
+// intermediate results held at once
+const bitsChunkSize = 4096
+
+// Bitset holds a decision per index of the objects passed to EnforceByEmailBatchBits
+type Bitset struct {
+	words []uint64
+	size  int
+}
+
+func newBitset(size int) *Bitset {
+	return &Bitset{words: make([]uint64, (size+63)/64), size: size}
+}
+
+// Len returns the number of decisions held
+func (b *Bitset) Len() int {
+	return b.size
+}
+
+// Test tells whether the object at index i was allowed, out of range indexes are denied
+func (b *Bitset) Test(i int) bool {
+	if i < 0 || i >= b.size {
+		return false
+	}
+	return b.words[i/64]&(1<<(uint(i)%64)) != 0
+}
+
+// Count returns the number of allowed objects
+func (b *Bitset) Count() int {
+	count := 0
+	for _, word := range b.words {
+		count += bits.OnesCount64(word)
+	}
+	return count
+}
+
+func (b *Bitset) set(i int) {
+	b.words[i/64] |= 1 << (uint(i) % 64)
+}
+
+// EnforceByEmailBatchBits is EnforceByEmailInBatch returning the decisions aligned to vals as a bitset, for callers
+// checking millions of objects. vals are evaluated in chunks so that no map of all of their results is built,
+// each chunk is cached as a batch of its own and only its objects are looked up in the cache. Empty objects are
+// denied. The call takes a single rate limit token of emailId, failing with ErrRateLimited and no decisions when
+// over the limit. Objects failing to evaluate are denied and the error of the first of them in vals is returned
+// along with the decisions, a chunk failing as a whole stops the evaluation and its error is returned along with
+// the decisions of the chunks before it
+func (e *EnforcerImpl) EnforceByEmailBatchBits(emailId string, resource string, action string, vals []string) (*Bitset, error) {
+	ctx, err := e.takeSubjectRateLimit(context.Background(), emailId)
+	if err != nil {
+		return newBitset(0), err
+	}
+	allowed := newBitset(len(vals))
+	// reused across chunks, the engine fills it with the chunk's objects only
+	result := make(map[string]bool)
+	var firstErr error
+	for start := 0; start < len(vals); start += bitsChunkSize {
+		end := start + bitsChunkSize
+		if end > len(vals) {
+			end = len(vals)
+		}
+		for object := range result {
+			delete(result, object)
+		}
+		_, objectErrs, err := e.enforceByEmailInBatchInto(ctx, result, emailId, resource, action, vals[start:end], getBatchSize(), nil)
+		if err != nil {
+			return allowed, err
+		}
+		for i, object := range vals[start:end] {
+			if objectErr, failed := objectErrs[object]; failed {
+				if object != "" && firstErr == nil {
+					firstErr = objectErr
+				}
+				continue
+			}
+			if result[object] {
+				allowed.set(start + i)
+			}
+		}
+	}
+	return allowed, firstErr
+}
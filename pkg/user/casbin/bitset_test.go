@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEnforceByEmailBatchBits(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	vals := []string{"team1/app1", "team4/app1", "", "team2/app1", "team1/app1"}
+	// spanning more than a chunk
+	for i := 0; len(vals) < bitsChunkSize+10; i++ {
+		vals = append(vals, fmt.Sprintf("team%d/app%d", i%5, i))
+	}
+	got, err := enforcer.EnforceByEmailBatchBits("user@example.com", "applications", "get", vals)
+	if err != nil {
+		t.Fatalf("EnforceByEmailBatchBits() error = %v", err)
+	}
+	if got.Len() != len(vals) {
+		t.Fatalf("Len() = %d, want %d", got.Len(), len(vals))
+	}
+	want := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals)
+	count := 0
+	for i, object := range vals {
+		if got.Test(i) != want[object] {
+			t.Errorf("Test(%d) of %q = %v, want %v", i, object, got.Test(i), want[object])
+		}
+		if want[object] {
+			count++
+		}
+	}
+	if got.Count() != count {
+		t.Errorf("Count() = %d, want %d", got.Count(), count)
+	}
+	if got.Test(-1) || got.Test(len(vals)) {
+		t.Errorf("Test() of an out of range index allowed")
+	}
+	if empty, err := enforcer.EnforceByEmailBatchBits("user@example.com", "applications", "get", nil); err != nil || empty.Len() != 0 || empty.Count() != 0 {
+		t.Errorf("EnforceByEmailBatchBits(nil) = %d decisions, want none", empty.Len())
+	}
+}
+
+func TestEnforceByEmailBatchBitsErrors(t *testing.T) {
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": failingMatcher}, testPolicies, testGroupings)
+	enforcer := newTestEnforcerFor(t, true, enf)
+	vals := make([]string, bitsChunkSize+2)
+	for i := range vals {
+		vals[i] = fmt.Sprintf("team1/app%d", i)
+	}
+	vals[bitsChunkSize+1] = "team1/broken"
+	got, err := enforcer.EnforceByEmailBatchBits("user@example.com", "applications", "get", vals)
+	if err == nil {
+		t.Errorf("EnforceByEmailBatchBits() of a failing object error = nil")
+	}
+	if got.Test(bitsChunkSize+1) || got.Count() != len(vals)-1 {
+		t.Errorf("EnforceByEmailBatchBits() of a failing object = %d allowed, want all but the failing object", got.Count())
+	}
+
+	t.Setenv("ENFORCER_STRICT_RESOURCES", "true")
+	strict := newTestEnforcer(t, true, testPolicies, testGroupings)
+	if _, err := strict.EnforceByEmailBatchBits("user@example.com", "applicatoins", "get", vals); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("EnforceByEmailBatchBits() of an unknown resource error = %v, want %v", err, codes.InvalidArgument)
+	}
+}
+
+func BenchmarkEnforceByEmailBatchBits(b *testing.B) {
+	vals := make([]string, 20000)
+	for i := range vals {
+		vals[i] = fmt.Sprintf("team%d/app%d", i%4, i)
+	}
+	forms := map[string]func(enforcer *EnforcerImpl) interface{}{
+		"map": func(enforcer *EnforcerImpl) interface{} {
+			return enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals)
+		},
+		"bits": func(enforcer *EnforcerImpl) interface{} {
+			allowed, _ := enforcer.EnforceByEmailBatchBits("user@example.com", "applications", "get", vals)
+			return allowed
+		},
+	}
+	for _, name := range []string{"map", "bits"} {
+		b.Run(name, func(b *testing.B) {
+			b.Setenv("ENFORCER_CACHE", "false")
+			enforcer := NewEnforcerImpl(newTestCasbinEnforcer(testPolicies, testGroupings), testSessionManager, nopLogger)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				forms[name](enforcer)
+			}
+			b.StopTimer()
+			// heap held by a single result
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			result := forms[name](enforcer)
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(after.HeapAlloc)-float64(before.HeapAlloc), "result-B")
+			runtime.KeepAlive(result)
+		})
+	}
+}
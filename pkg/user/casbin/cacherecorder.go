@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cacheRecorder writes a line per cache mutation for replaying the decision timeline while debugging, lines are
+// written through so that they survive a crash. enabled is checked before taking the mutex, keeping the disabled
+// recorder to an atomic load
+type cacheRecorder struct {
+	enabled int32
+	mutex   sync.Mutex
+	writer  io.Writer
+}
+
+// SetCacheRecorder writes every cache store and invalidation to writer, nil disables the recording. Lines are
+// "timestamp store email key object=allow|deny...", "timestamp invalidate email" and "timestamp invalidate-all",
+// key being the resource and action joined as resource + "$$" + action
+func (e *EnforcerImpl) SetCacheRecorder(writer io.Writer) {
+	e.cacheRecorder.mutex.Lock()
+	defer e.cacheRecorder.mutex.Unlock()
+	e.cacheRecorder.writer = writer
+	enabled := int32(0)
+	if writer != nil {
+		enabled = 1
+	}
+	atomic.StoreInt32(&e.cacheRecorder.enabled, enabled)
+}
+
+// openCacheRecorder records to the file at path, appending to it, see EnforcerConfig.CacheDebugLogPath
+func (e *EnforcerImpl) openCacheRecorder(path string) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		e.logger.Errorw("error in opening cache debug log, cache mutations are not recorded", "path", path, "err", err)
+		return
+	}
+	e.SetCacheRecorder(file)
+}
+
+func (e *EnforcerImpl) recordCacheStore(emailId string, results map[string]map[string]bool) {
+	if atomic.LoadInt32(&e.cacheRecorder.enabled) == 0 {
+		return
+	}
+	now := time.Now()
+	keys := make([]string, 0, len(results))
+	for key := range results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		objects := make([]string, 0, len(results[key]))
+		for object, allowed := range results[key] {
+			decision := "deny"
+			if allowed {
+				decision = "allow"
+			}
+			objects = append(objects, object+"="+decision)
+		}
+		sort.Strings(objects)
+		e.writeCacheRecord(now, "store", emailId, key, strings.Join(objects, " "))
+	}
+}
+
+func (e *EnforcerImpl) recordCacheInvalidation(emailId string) {
+	if atomic.LoadInt32(&e.cacheRecorder.enabled) == 0 {
+		return
+	}
+	e.writeCacheRecord(time.Now(), "invalidate", emailId)
+}
+
+func (e *EnforcerImpl) recordCompleteCacheInvalidation() {
+	if atomic.LoadInt32(&e.cacheRecorder.enabled) == 0 {
+		return
+	}
+	e.writeCacheRecord(time.Now(), "invalidate-all")
+}
+
+func (e *EnforcerImpl) writeCacheRecord(now time.Time, fields ...string) {
+	e.cacheRecorder.mutex.Lock()
+	defer e.cacheRecorder.mutex.Unlock()
+	if e.cacheRecorder.writer == nil {
+		return
+	}
+	line := now.UTC().Format(time.RFC3339Nano) + " " + strings.TrimSpace(strings.Join(fields, " ")) + "\n"
+	if _, err := io.WriteString(e.cacheRecorder.writer, line); err != nil {
+		e.logger.Errorw("error in writing cache debug log", "err", err)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cacheRecords returns the lines of a cache debug log without their timestamps
+func cacheRecords(t *testing.T, log string) []string {
+	var records []string
+	for _, line := range strings.Split(strings.TrimSpace(log), "\n") {
+		timestamp, record, _ := strings.Cut(line, " ")
+		if _, err := time.Parse(time.RFC3339Nano, timestamp); err != nil {
+			t.Errorf("cache record %q timestamp: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestCacheRecorder(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1")
+	buffer := &bytes.Buffer{}
+	enforcer.SetCacheRecorder(buffer)
+
+	enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team4/app1", "team2/app1"})
+	enforcer.EnforceByEmail("user@example.com", "applications", "delete", "team3/app1")
+	enforcer.InvalidateCache("user@example.com")
+	enforcer.EnforceByEmail("other@example.com", "applications", "get", "team1/app1")
+	enforcer.InvalidateCompleteCache()
+	enforcer.SetCacheRecorder(nil)
+	enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1")
+
+	want := []string{
+		// batches store the objects found in the cache along with the evaluated ones
+		"store user@example.com applications$$get team1/app1=allow team2/app1=allow team4/app1=deny",
+		"store user@example.com applications$$delete team3/app1=allow",
+		"invalidate user@example.com",
+		"store other@example.com applications$$get team1/app1=deny",
+		"invalidate-all",
+	}
+	if got := cacheRecords(t, buffer.String()); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("cache records = %q, want %q", got, want)
+	}
+}
+
+func TestCacheDebugLogPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	t.Setenv("ENFORCER_CACHE_DEBUG_LOG_PATH", path)
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1")
+	enforcer.InvalidateCache("user@example.com")
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error in reading cache debug log: %v", err)
+	}
+	want := []string{"store user@example.com applications$$get team1/app1=allow", "invalidate user@example.com"}
+	if got := cacheRecords(t, string(log)); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("cache records = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"context"
+)
+
+// newBatchSlots returns the slots bounding the goroutines of all concurrent batches, nil for no bound
+func newBatchSlots(config *EnforcerConfig) chan struct{} {
+	if config.MaxBatchGoroutines <= 0 {
+		return nil
+	}
+	return make(chan struct{}, config.MaxBatchGoroutines)
+}
+
+// acquireBatchSlot blocks until another batch goroutine may be started, false if ctx is done first
+func (e *EnforcerImpl) acquireBatchSlot(ctx context.Context) bool {
+	if e.batchSlots == nil {
+		return true
+	}
+	select {
+	case e.batchSlots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// releaseBatchSlot is called by a batch goroutine started after acquireBatchSlot when it is done
+func (e *EnforcerImpl) releaseBatchSlot() {
+	if e.batchSlots != nil {
+		<-e.batchSlots
+	}
+}
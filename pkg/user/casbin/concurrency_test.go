@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxBatchGoroutines(t *testing.T) {
+	const maxGoroutines = 4
+	const batches = 20
+	t.Setenv("ENFORCER_MAX_BATCH_GOROUTINES", fmt.Sprint(maxGoroutines))
+	t.Setenv("ENFORCER_MAX_BATCH_SIZE", "10")
+	t.Setenv("ENFORCER_BATCH_SYNC_THRESHOLD", "0")
+	var active, maxActive int32
+	matcher := func(args ...interface{}) (interface{}, error) {
+		// objects are matched once per policy of the subject, counting the evaluation of one of them
+		if args[1].(string) == "team1/*" {
+			current := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				observed := atomic.LoadInt32(&maxActive)
+				if current <= observed || atomic.CompareAndSwapInt32(&maxActive, observed, current) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return MatchKeyByPartFunc(args...)
+	}
+	enf := newTestCasbinEnforcerWithModel(testModel, map[string]matcherFunc{"matchKeyByPart": matcher}, testPolicies, testGroupings)
+	enforcer := newTestEnforcerFor(t, false, enf)
+
+	baseline := runtime.NumGoroutine()
+	var maxGoroutinesSeen int32
+	stop := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				if count := int32(runtime.NumGoroutine()); count > atomic.LoadInt32(&maxGoroutinesSeen) {
+					atomic.StoreInt32(&maxGoroutinesSeen, count)
+				}
+				time.Sleep(100 * time.Microsecond)
+			}
+		}
+	}()
+	wg := sync.WaitGroup{}
+	for i := 0; i < batches; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vals := make([]string, 20)
+			for j := range vals {
+				vals[j] = fmt.Sprintf("team1/app%d-%d", i, j)
+			}
+			result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals)
+			for _, object := range vals {
+				if !result[object] {
+					t.Errorf("EnforceByEmailInBatch() denied %s", object)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(stop)
+	<-sampled
+
+	if maxActive > maxGoroutines {
+		t.Errorf("objects evaluated concurrently = %d, want at most %d", maxActive, maxGoroutines)
+	}
+	// the sampler, the callers and the bounded batch goroutines
+	if bound := int32(baseline + 1 + batches + maxGoroutines); maxGoroutinesSeen > bound {
+		t.Errorf("goroutines = %d, want at most %d", maxGoroutinesSeen, bound)
+	}
+}
+
+func TestMixedBatchGroupGoroutines(t *testing.T) {
+	const maxGoroutines = 2
+	t.Setenv("ENFORCER_MAX_BATCH_GOROUTINES", fmt.Sprint(maxGoroutines))
+	// single object groups are evaluated on the group's goroutine, without a batch slot
+	t.Setenv("ENFORCER_BATCH_SYNC_THRESHOLD", "1")
+	var active, maxActive int32
+	matcher := func(args ...interface{}) (interface{}, error) {
+		if args[1].(string) == "team3/*" {
+			current := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				observed := atomic.LoadInt32(&maxActive)
+				if current <= observed || atomic.CompareAndSwapInt32(&maxActive, observed, current) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return MatchKeyByPartFunc(args...)
+	}
+	enf := newTestCasbinEnforcerWithModel(testModel, map[string]matcherFunc{"matchKeyByPart": matcher}, testPolicies, testGroupings)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	checks := make([]ResourceActionObject, 20)
+	for i := range checks {
+		checks[i] = ResourceActionObject{Resource: "applications", Action: fmt.Sprintf("action%d", i), Object: "team3/app1"}
+	}
+	result, err := enforcer.EnforceByEmailMixedBatch("user@example.com", checks)
+	if err != nil {
+		t.Fatalf("EnforceByEmailMixedBatch() error = %v", err)
+	}
+	for _, check := range checks {
+		if !result[check] {
+			t.Errorf("EnforceByEmailMixedBatch() denied %v", check)
+		}
+	}
+	if maxActive > maxGoroutines {
+		t.Errorf("groups evaluated concurrently = %d, want at most %d", maxActive, maxGoroutines)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import "strings"
+
+// ExplainResult is the decision for an object along with the policies of the user and its roles which matched
+// the request, each policy is formatted as "sub, res, act, obj, eft"
+type ExplainResult struct {
+	Allowed bool     `json:"allowed"`
+	Matched []string `json:"matched"`
+}
+
+// ExplainEnforceByEmailInBatch is a debugging aid which evaluates vals serially, bypassing the cache, and reports
+// which policies matched each object. It is not meant for the request path
+func (e *EnforcerImpl) ExplainEnforceByEmailInBatch(emailId string, resource string, action string, vals []string) map[string]ExplainResult {
+	emailId = strings.ToLower(emailId)
+	resource, action = e.normalizeKeys(resource, action)
+	permissions := e.getImplicitPermissions(emailId)
+	result := make(map[string]ExplainResult, len(vals))
+	for _, item := range vals {
+		allowed, err := e.enforceByEmailE(e.Enforcer, emailId, resource, action, item)
+		explainResult := ExplainResult{Allowed: allowed && err == nil, Matched: []string{}}
+		for _, permission := range permissions {
+			if policyMatches(permission, resource, action, item) {
+				explainResult.Matched = append(explainResult.Matched, strings.Join(permission, ", "))
+			}
+		}
+		result[item] = explainResult
+	}
+	return result
+}
+
+func (e *EnforcerImpl) getImplicitPermissions(emailId string) (permissions [][]string) {
+	defer handlePanic()
+	return e.Enforcer.GetImplicitPermissionsForUser(emailId)
+}
+
+// policyMatches applies the model's matchers to a "sub, res, act, obj, eft" policy, subject is expected to be
+// resolved already
+func policyMatches(policy []string, resource string, action string, object string) bool {
+	if len(policy) < 4 {
+		return false
+	}
+	return MatchKeyByPart(resource, policy[1]) && MatchKeyByPart(action, policy[2]) && MatchKeyByPart(object, policy[3])
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExplainEnforceByEmailInBatch(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	got := enforcer.ExplainEnforceByEmailInBatch("User@example.com", "applications", "get", []string{"team1/app1", "team3/app1", "team2/app2"})
+	want := map[string]ExplainResult{
+		"team1/app1": {Allowed: true, Matched: []string{"user@example.com, applications, get, team1/*, allow"}},
+		"team3/app1": {Allowed: true, Matched: []string{"role:team3-admin, applications, *, team3/*, allow"}},
+		"team2/app2": {Allowed: false, Matched: []string{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExplainEnforceByEmailInBatch() = %v, want %v", got, want)
+	}
+}
+
+func TestExplainEnforceByEmailInBatchBypassesCache(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	enforcer.PrimeCacheBatch("user@example.com", map[string]map[string]bool{getCacheKey("", "applications", "get"): {"team1/app1": false}})
+	got := enforcer.ExplainEnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1", "team2/app1"})
+	if !got["team1/app1"].Allowed || !got["team2/app1"].Allowed {
+		t.Errorf("ExplainEnforceByEmailInBatch() = %v, want the policy's decisions over the cached one", got)
+	}
+	if enforcer.IsCached("user@example.com", "applications", "get", "team2/app1") {
+		t.Errorf("ExplainEnforceByEmailInBatch() cached its decisions")
+	}
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"sync/atomic"
+)
+
+// emailCacheEntry is the cached value of an email, results are keyed by getCacheKey and were evaluated under
+// the policy generation they are stamped with
+type emailCacheEntry struct {
+	generation uint64
+	results    map[string]map[string]cacheDecision
+}
+
+// ReloadPolicy reloads the policies of the wrapped enforcer from its adapter. Every successful reload starts a new
+// policy generation, entries cached under an older generation are treated as misses
+func (e *EnforcerImpl) ReloadPolicy() error {
+	if err := e.Enforcer.LoadPolicy(); err != nil {
+		return err
+	}
+	e.bumpPolicyGeneration()
+	e.MarkPolicyLoaded()
+	return nil
+}
+
+// PolicyGeneration returns the number of policy reloads, see ReloadPolicy
+func (e *EnforcerImpl) PolicyGeneration() uint64 {
+	return atomic.LoadUint64(&e.policyGeneration)
+}
+
+func (e *EnforcerImpl) bumpPolicyGeneration() {
+	atomic.AddUint64(&e.policyGeneration, 1)
+}
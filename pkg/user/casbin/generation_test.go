@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	fileadapter "github.com/casbin/casbin/persist/file-adapter"
+)
+
+func TestReloadPolicyMissesOldGeneration(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.csv")
+	writePolicies := func(policies string) {
+		if err := os.WriteFile(policyFile, []byte(policies), 0600); err != nil {
+			t.Fatalf("error in writing policy file: %v", err)
+		}
+	}
+	writePolicies("p, user@example.com, applications, get, team1/*, allow\n")
+	enf, err := NewEnforcerWithEmbeddedModel(fileadapter.NewAdapter(policyFile))
+	if err != nil {
+		t.Fatalf("NewEnforcerWithEmbeddedModel() = %v", err)
+	}
+	enforcer := newTestEnforcerFor(t, true, enf)
+	emailId := "user@example.com"
+	vals := []string{"team1/app1", "team2/app1"}
+	if got := enforcer.EnforceByEmailInBatch(emailId, "applications", "get", vals); !got["team1/app1"] || got["team2/app1"] {
+		t.Fatalf("EnforceByEmailInBatch() before reload = %v", got)
+	}
+	if _, found := getCachedObjects(enforcer, emailId, "applications", "get"); !found {
+		t.Fatalf("batch results not cached")
+	}
+
+	writePolicies("p, user@example.com, applications, get, team2/*, allow\n")
+	generation := enforcer.PolicyGeneration()
+	if err := enforcer.ReloadPolicy(); err != nil {
+		t.Fatalf("ReloadPolicy() = %v", err)
+	}
+	if enforcer.PolicyGeneration() != generation+1 {
+		t.Errorf("PolicyGeneration() = %d, want %d", enforcer.PolicyGeneration(), generation+1)
+	}
+	if _, found := getCachedObjects(enforcer, emailId, "applications", "get"); found {
+		t.Errorf("entry of the old generation read as a hit after reload")
+	}
+	if got := enforcer.EnforceByEmailInBatch(emailId, "applications", "get", vals); got["team1/app1"] || !got["team2/app1"] {
+		t.Errorf("EnforceByEmailInBatch() after reload = %v, want the reloaded policy", got)
+	}
+	if _, found := getCachedObjects(enforcer, emailId, "applications", "get"); !found {
+		t.Errorf("results of the new generation not cached")
+	}
+
+	// results evaluated before a reload are not stored under the new generation
+	storeCacheDataAt(enforcer, generation, emailId, "applications", "delete", map[string]bool{"team1/app1": true})
+	if _, found := getCachedObjects(enforcer, emailId, "applications", "delete"); found {
+		t.Errorf("stale results stored after reload")
+	}
+}
+
+func TestEnforceByEmailUntilDenyMissesReloadDuringEvaluation(t *testing.T) {
+	var enforcer *EnforcerImpl
+	reload := func(args ...interface{}) (interface{}, error) {
+		// a reload completing while the objects are evaluated
+		enforcer.bumpPolicyGeneration()
+		return MatchKeyByPartFunc(args...)
+	}
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": reload}, testPolicies, testGroupings)
+	enforcer = newTestEnforcerFor(t, true, enf)
+	if allAllowed, firstDenied := enforcer.EnforceByEmailUntilDeny("user@example.com", "applications", "get", []string{"team1/app1", "team2/app1"}); !allAllowed {
+		t.Fatalf("EnforceByEmailUntilDeny() denied %s", firstDenied)
+	}
+	if cached, found := getCachedObjects(enforcer, "user@example.com", "applications", "get"); found {
+		t.Errorf("results evaluated before the reload cached as %v", cached)
+	}
+}
+
+func TestAdapterPolicyEditsKeepGeneration(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.csv")
+	if err := os.WriteFile(policyFile, []byte("p, user@example.com, applications, get, team1/*, allow\n"), 0600); err != nil {
+		t.Fatalf("error in writing policy file: %v", err)
+	}
+	previous, previousImpl := e, GlobalEnforcerImpl()
+	defer func() {
+		e = previous
+		SetGlobalEnforcerImpl(previousImpl)
+	}()
+	enf, err := NewEnforcerWithEmbeddedModel(fileadapter.NewAdapter(policyFile))
+	if err != nil {
+		t.Fatalf("NewEnforcerWithEmbeddedModel() = %v", err)
+	}
+	e = enf
+	enforcer := newTestEnforcerFor(t, true, enf)
+	enforcer.EnforceByEmailInBatch("other@example.com", "applications", "get", []string{"team1/app1"})
+	generation := enforcer.PolicyGeneration()
+
+	AddPolicy([]Policy{{Type: "p", Sub: "user@example.com", Res: "applications", Act: "get", Obj: "team2/*"}})
+	RemovePolicy([]Policy{{Type: "p", Sub: "user@example.com", Res: "applications", Act: "get", Obj: "team2/*"}})
+	if enforcer.PolicyGeneration() != generation {
+		t.Errorf("PolicyGeneration() after policy edits = %d, want %d", enforcer.PolicyGeneration(), generation)
+	}
+	if _, found := getCachedObjects(enforcer, "other@example.com", "applications", "get"); !found {
+		t.Errorf("entry of a subject the edits don't touch dropped")
+	}
+
+	LoadPolicy()
+	if enforcer.PolicyGeneration() != generation+1 {
+		t.Errorf("PolicyGeneration() after LoadPolicy() = %d, want %d", enforcer.PolicyGeneration(), generation+1)
+	}
+	if _, found := getCachedObjects(enforcer, "other@example.com", "applications", "get"); found {
+		t.Errorf("entry of the old generation read as a hit after LoadPolicy()")
+	}
+}
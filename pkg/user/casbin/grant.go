@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+// EnforceWithGrantingRole is EnforceResolve reporting, on allow, the role whose policy granted the request, for
+// audit. The role is empty for grants of a policy of the subject itself or of the principal allow list, and "*"
+// for grants of a policy written for every subject. Roles are searched nearest first, ENFORCER_DEFAULT_ROLE last
+func (e *EnforcerImpl) EnforceWithGrantingRole(token string, resource string, action string, object string) (bool, string, error) {
+	allowed, subject, err := e.EnforceResolve(token, resource, action, object)
+	if !allowed || err != nil {
+		return allowed, "", err
+	}
+	return true, e.grantingRole(subject, resource, action, object), nil
+}
+
+// grantingRole finds the role of the first allow policy matching the request, its actions including those granting
+// action through SetActionInheritance. Policies are matched the way auth_model.conf does
+func (e *EnforcerImpl) grantingRole(subject string, resource string, action string, object string) string {
+	actions := append([]string{action}, e.grantingActions(action)...)
+	candidates := append([]string{subject}, e.Enforcer.GetImplicitRolesForUser(subject)...)
+	if defaultRole := e.config.DefaultRole; defaultRole != "" {
+		candidates = append(candidates, defaultRole)
+		candidates = append(candidates, e.Enforcer.GetImplicitRolesForUser(defaultRole)...)
+	}
+	candidates = append(candidates, "*")
+	for _, candidate := range candidates {
+		for _, policy := range e.Enforcer.GetFilteredPolicy(0, candidate) {
+			if len(policy) < 5 || policy[4] != "allow" || !matchesPolicy(policy, resource, actions, object) {
+				continue
+			}
+			if candidate == subject {
+				return ""
+			}
+			return candidate
+		}
+	}
+	return ""
+}
+
+// matchesPolicy tells whether policy, sub, res, act, obj and eft, matches resource, object and any of actions
+func matchesPolicy(policy []string, resource string, actions []string, object string) bool {
+	if !MatchKeyByPart(resource, policy[1]) || !MatchKeyByPart(object, policy[3]) {
+		return false
+	}
+	for _, action := range actions {
+		if MatchKeyByPart(action, policy[2]) {
+			return true
+		}
+	}
+	return false
+}
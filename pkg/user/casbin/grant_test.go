@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestEnforceWithGrantingRole(t *testing.T) {
+	policies := append([][]string{
+		{"role:viewer", "environment", "get", "*", "allow"},
+		{"*", "applications", "get", "public/*", "allow"},
+	}, testPolicies...)
+	groupings := append([][]string{{"role:team3-admin", "role:viewer"}}, testGroupings...)
+	enf := newTestCasbinEnforcerWithModel(DefaultModel, map[string]matcherFunc{"matchSubject": MatchSubjectFunc}, policies, groupings)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+	tests := []struct {
+		name        string
+		resource    string
+		action      string
+		object      string
+		wantAllowed bool
+		wantRole    string
+	}{
+		{name: "direct grant", resource: "applications", action: "get", object: "team1/app1", wantAllowed: true, wantRole: ""},
+		{name: "grant of a role", resource: "applications", action: "delete", object: "team3/app1", wantAllowed: true, wantRole: "role:team3-admin"},
+		{name: "grant of an inherited role", resource: "environment", action: "get", object: "env1/app1", wantAllowed: true, wantRole: "role:viewer"},
+		{name: "grant to every subject", resource: "applications", action: "get", object: "public/app1", wantAllowed: true, wantRole: "*"},
+		{name: "denied", resource: "applications", action: "delete", object: "team1/app1", wantAllowed: false, wantRole: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, role, err := enforcer.EnforceWithGrantingRole(token, tt.resource, tt.action, tt.object)
+			if err != nil || allowed != tt.wantAllowed || role != tt.wantRole {
+				t.Errorf("EnforceWithGrantingRole() = %v, %q, %v, want %v, %q", allowed, role, err, tt.wantAllowed, tt.wantRole)
+			}
+		})
+	}
+
+	if _, _, err := enforcer.EnforceWithGrantingRole("invalid", "applications", "get", "team1/app1"); err == nil {
+		t.Errorf("EnforceWithGrantingRole() with invalid token returned no error")
+	}
+}
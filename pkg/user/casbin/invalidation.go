@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"context"
+	"sync"
+)
+
+// InvalidationEvent describes a cache invalidation for the other replicas sharing the policies, Complete events
+// flush the whole cache, the others only EmailId's entry. Namespace is the CacheNamespace of the publishing enforcer
+type InvalidationEvent struct {
+	Namespace string `json:"namespace,omitempty"`
+	EmailId   string `json:"emailId,omitempty"`
+	Complete  bool   `json:"complete"`
+}
+
+// InvalidationPublisher fans an invalidation out to the other replicas, e.g. over a redis pub/sub channel
+type InvalidationPublisher func(ctx context.Context, event InvalidationEvent) error
+
+// invalidationHook holds the publisher invoked on every invalidation
+type invalidationHook struct {
+	mutex     sync.RWMutex
+	publisher InvalidationPublisher
+}
+
+// SetInvalidationPublisher sets publisher to be invoked after every local invalidation through InvalidateCache and
+// InvalidateCompleteCache, nil removes it. Replicas receiving the events apply them through ApplyInvalidation
+func (e *EnforcerImpl) SetInvalidationPublisher(publisher InvalidationPublisher) {
+	e.invalidation.mutex.Lock()
+	defer e.invalidation.mutex.Unlock()
+	e.invalidation.publisher = publisher
+}
+
+// InvalidateCacheWithContext is InvalidateCache passing ctx to the publisher, the local entry is dropped even if
+// publishing fails
+func (e *EnforcerImpl) InvalidateCacheWithContext(ctx context.Context, emailId string) (bool, error) {
+	invalidated := e.invalidateLocalCache(emailId)
+	return invalidated, e.publishInvalidation(ctx, InvalidationEvent{Namespace: e.config.CacheNamespace, EmailId: emailId})
+}
+
+// InvalidateCompleteCacheWithContext is InvalidateCompleteCache passing ctx to the publisher, the local cache is
+// flushed even if publishing fails
+func (e *EnforcerImpl) InvalidateCompleteCacheWithContext(ctx context.Context) error {
+	e.invalidateLocalCompleteCache()
+	return e.publishInvalidation(ctx, InvalidationEvent{Namespace: e.config.CacheNamespace, Complete: true})
+}
+
+// ApplyInvalidation applies an event published by another replica to the local cache only, so it isn't published
+// again. Events of other cache namespaces are ignored
+func (e *EnforcerImpl) ApplyInvalidation(event InvalidationEvent) {
+	if event.Namespace != e.config.CacheNamespace {
+		return
+	}
+	if event.Complete {
+		e.invalidateLocalCompleteCache()
+	} else if event.EmailId != "" {
+		e.invalidateLocalCache(event.EmailId)
+	}
+}
+
+func (e *EnforcerImpl) publishInvalidation(ctx context.Context, event InvalidationEvent) error {
+	e.invalidation.mutex.RLock()
+	publisher := e.invalidation.publisher
+	e.invalidation.mutex.RUnlock()
+	if publisher == nil {
+		return nil
+	}
+	return publisher(ctx, event)
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestInvalidationPublisher(t *testing.T) {
+	t.Setenv("ENFORCER_CACHE_NAMESPACE", "replicas")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	var published []InvalidationEvent
+	enforcer.SetInvalidationPublisher(func(ctx context.Context, event InvalidationEvent) error {
+		published = append(published, event)
+		return nil
+	})
+	enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1"})
+	if !enforcer.InvalidateCache("user@example.com") {
+		t.Errorf("InvalidateCache() = false, want true")
+	}
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); len(cached) != 0 {
+		t.Errorf("cache after InvalidateCache = %v, want it dropped locally", cached)
+	}
+	enforcer.InvalidateCompleteCache()
+	want := []InvalidationEvent{
+		{Namespace: "replicas", EmailId: "user@example.com"},
+		{Namespace: "replicas", Complete: true},
+	}
+	if !reflect.DeepEqual(published, want) {
+		t.Errorf("published events = %+v, want %+v", published, want)
+	}
+
+	published = nil
+	enforcer.ApplyInvalidation(InvalidationEvent{Namespace: "replicas", Complete: true})
+	if published != nil {
+		t.Errorf("ApplyInvalidation() published %+v, want the event applied locally only", published)
+	}
+}
+
+func TestInvalidationPublisherError(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	publishErr := errors.New("redis unavailable")
+	enforcer.SetInvalidationPublisher(func(ctx context.Context, event InvalidationEvent) error {
+		return publishErr
+	})
+	enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1"})
+	if err := enforcer.InvalidateCompleteCacheWithContext(context.Background()); err != publishErr {
+		t.Errorf("InvalidateCompleteCacheWithContext() error = %v, want %v", err, publishErr)
+	}
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); len(cached) != 0 {
+		t.Errorf("cache after failed publish = %v, want it flushed locally", cached)
+	}
+}
+
+func TestApplyInvalidation(t *testing.T) {
+	t.Setenv("ENFORCER_CACHE_NAMESPACE", "replicas")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1"})
+	enforcer.ApplyInvalidation(InvalidationEvent{Namespace: "other", Complete: true})
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); len(cached) != 1 {
+		t.Errorf("cache after event of another namespace = %v, want it kept", cached)
+	}
+	enforcer.ApplyInvalidation(InvalidationEvent{Namespace: "replicas", EmailId: "user@example.com"})
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); len(cached) != 0 {
+		t.Errorf("cache after event of the email = %v, want it dropped", cached)
+	}
+}
@@ -0,0 +1,468 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MatchSubjectFunc is the casbin wrapper of MatchSubject
+func MatchSubjectFunc(args ...interface{}) (interface{}, error) {
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return bool(MatchSubject(name1, name2)), nil
+}
+
+// MatchSubject checks whether policySubject grants every subject, i.e. is "*". Unlike objects, subjects support no
+// partial wildcards, "user*" only matches itself through the role hierarchy. Empty subjects never match
+func MatchSubject(requestedSubject string, policySubject string) bool {
+	return policySubject == "*" && requestedSubject != ""
+}
+
+// MatchResourceHierarchyFunc is the casbin wrapper of MatchResourceHierarchy
+func MatchResourceHierarchyFunc(args ...interface{}) (interface{}, error) {
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return bool(MatchResourceHierarchy(name1, name2)), nil
+}
+
+// MatchResourceHierarchy checks whether policyPath is a segment wise prefix of requestedPath, so that a grant on a
+// parent resource implies the same grant on all of its children. Each segment is matched using MatchKeyByPart.
+// Empty segments are not allowed in requestedPath, as in MatchKeyByPart.
+// For example - policyPath = "app/prod" matches requestedPath = "app/prod" and "app/prod/myapp" but not "app/staging"
+func MatchResourceHierarchy(requestedPath string, policyPath string) bool {
+	requestedVals := strings.Split(requestedPath, "/")
+	policyVals := strings.Split(policyPath, "/")
+	if len(policyVals) > len(requestedVals) {
+		return false
+	}
+	for _, requestedVal := range requestedVals[len(policyVals):] {
+		if requestedVal == "" {
+			return false
+		}
+	}
+	for i, policyVal := range policyVals {
+		if !matchSegment(requestedVals[i], policyVal) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchKeyByPartRecursiveFunc is the casbin wrapper of MatchKeyByPartRecursive
+func MatchKeyByPartRecursiveFunc(args ...interface{}) (interface{}, error) {
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return bool(MatchKeyByPartRecursive(name1, name2)), nil
+}
+
+// MatchKeyByPartRecursive is MatchKeyByPart where a "**" segment in key2 matches zero or more segments of key1,
+// any number of "**" segments is supported. Other segments are matched as in MatchKeyByPart, empty segments are not
+// allowed in key1.
+// For example - key2 = "a/**/d" matches key1 = "a/d" and "a/x/y/d" but not "a/x/y/e"
+func MatchKeyByPartRecursive(key1 string, key2 string) bool {
+	if key2 == "*" {
+		return true
+	}
+	key1Vals := strings.Split(key1, "/")
+	key2Vals := strings.Split(key2, "/")
+
+	// matched[i][j] tells whether key1Vals[i:] matches key2Vals[j:], filled from the end
+	matched := make([][]bool, len(key1Vals)+1)
+	for i := range matched {
+		matched[i] = make([]bool, len(key2Vals)+1)
+	}
+	matched[len(key1Vals)][len(key2Vals)] = true
+	for i := len(key1Vals); i >= 0; i-- {
+		for j := len(key2Vals) - 1; j >= 0; j-- {
+			if key2Vals[j] == "**" {
+				// either "**" matches nothing, or it consumes key1Vals[i] and stays available
+				matched[i][j] = matched[i][j+1] || (i < len(key1Vals) && key1Vals[i] != "" && matched[i+1][j])
+			} else if i < len(key1Vals) {
+				matched[i][j] = matchSegment(key1Vals[i], key2Vals[j]) && matched[i+1][j+1]
+			}
+		}
+	}
+	return matched[0][0]
+}
+
+// MatchKeyByPartSep returns the casbin function of MatchKeyByPart splitting keys by sep instead of "/", for
+// identifiers such as ARNs whose parts are ":" separated. It is registered under a name of the caller's choice,
+// e.g. enforcer.AddFunction("matchKeyByColon", MatchKeyByPartSep(":"))
+func MatchKeyByPartSep(sep string) func(args ...interface{}) (interface{}, error) {
+	if sep == "" {
+		sep = "/"
+	}
+	return func(args ...interface{}) (interface{}, error) {
+		name1 := args[0].(string)
+		name2 := args[1].(string)
+
+		return matchKeyByPartSep(name1, name2, sep), nil
+	}
+}
+
+// MatchKeyByPartAnyFunc is the casbin wrapper of MatchKeyByPartAny
+func MatchKeyByPartAnyFunc(args ...interface{}) (interface{}, error) {
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return bool(MatchKeyByPartAny(name1, name2)), nil
+}
+
+// MatchKeyByPartAny matches key1 against the "," separated alternatives of key2, each alternative is matched using
+// MatchKeyByPart. Spaces around alternatives are ignored, empty alternatives never match.
+// For example - key2 = "team1/app1,team2/*" matches key1 = "team1/app1" and "team2/app2" but not "team1/app2"
+func MatchKeyByPartAny(key1 string, key2 string) bool {
+	for _, alternative := range strings.Split(key2, ",") {
+		alternative = strings.TrimSpace(alternative)
+		if alternative != "" && MatchKeyByPart(key1, alternative) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchKeyByPartOrFunc is the casbin wrapper of MatchKeyByPartOr
+func MatchKeyByPartOrFunc(args ...interface{}) (interface{}, error) {
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return bool(MatchKeyByPartOr(name1, name2)), nil
+}
+
+// MatchKeyByPartOr matches key1 against the "|" separated alternative patterns of key2, each matched using
+// MatchKeyByPart. A key2 without "|" is matched by MatchKeyByPart as is.
+// For example - key2 = "app/prod/*|app/staging/*" matches key1 = "app/prod/web" and "app/staging/web" but not
+// "app/dev/web"
+func MatchKeyByPartOr(key1 string, key2 string) bool {
+	if !strings.Contains(key2, "|") {
+		return MatchKeyByPart(key1, key2)
+	}
+	for _, alternative := range strings.Split(key2, "|") {
+		if alternative != "" && MatchKeyByPart(key1, alternative) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchKeyByPartRangeFunc is the casbin wrapper of MatchKeyByPartRange
+func MatchKeyByPartRangeFunc(args ...interface{}) (interface{}, error) {
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return bool(MatchKeyByPartRange(name1, name2)), nil
+}
+
+// MatchKeyByPartRange is MatchKeyByPart where a segment of key2 may hold a numeric range "[low-high]", matching a
+// key1 segment with the same text around it and a decimal number within the bounds, both inclusive. Numbers with
+// leading zeros and segments with malformed ranges are matched literally. Other segments are matched as in
+// MatchKeyByPart, empty segments are not allowed in key1.
+// For example - key2 = "team1/build[1-100]" matches key1 = "team1/build42" but not "team1/build101" or "team1/buildx"
+func MatchKeyByPartRange(key1 string, key2 string) bool {
+	if key2 == "*" {
+		return true
+	}
+	key1Vals := strings.Split(key1, "/")
+	key2Vals := strings.Split(key2, "/")
+	if len(key1Vals) != len(key2Vals) {
+		return false
+	}
+	for i, key2Val := range key2Vals {
+		if numericRange, ok := getSegmentRange(key2Val); ok {
+			if !numericRange.matches(key1Vals[i]) {
+				return false
+			}
+		} else if !matchSegment(key1Vals[i], key2Val) {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentRange is a parsed "prefix[low-high]suffix" policy segment
+type segmentRange struct {
+	prefix string
+	suffix string
+	low    uint64
+	high   uint64
+}
+
+// maxSegmentRanges bounds the policy segments cached in segmentRanges, segments beyond it are parsed on every match
+const maxSegmentRanges = 4096
+
+// segmentRanges caches the parsed range of up to maxSegmentRanges policy segments, nil for segments without a range,
+// segmentRangeCount counts its entries
+var (
+	segmentRanges     sync.Map
+	segmentRangeCount int64
+)
+
+func getSegmentRange(segment string) (*segmentRange, bool) {
+	if !strings.Contains(segment, "[") {
+		return nil, false
+	}
+	if parsed, found := segmentRanges.Load(segment); found {
+		numericRange := parsed.(*segmentRange)
+		return numericRange, numericRange != nil
+	}
+	numericRange := parseSegmentRange(segment)
+	if atomic.LoadInt64(&segmentRangeCount) < maxSegmentRanges {
+		if _, loaded := segmentRanges.LoadOrStore(segment, numericRange); !loaded {
+			atomic.AddInt64(&segmentRangeCount, 1)
+		}
+	}
+	return numericRange, numericRange != nil
+}
+
+// parseSegmentRange parses the first "[low-high]" of segment, nil if it has none or low exceeds high
+func parseSegmentRange(segment string) *segmentRange {
+	prefix, rest, found := strings.Cut(segment, "[")
+	if !found {
+		return nil
+	}
+	bounds, suffix, found := strings.Cut(rest, "]")
+	if !found {
+		return nil
+	}
+	lowText, highText, found := strings.Cut(bounds, "-")
+	if !found {
+		return nil
+	}
+	low, ok := parseSegmentNumber(lowText)
+	if !ok {
+		return nil
+	}
+	high, ok := parseSegmentNumber(highText)
+	if !ok || low > high {
+		return nil
+	}
+	return &segmentRange{prefix: prefix, suffix: suffix, low: low, high: high}
+}
+
+func (r *segmentRange) matches(value string) bool {
+	if len(value) < len(r.prefix)+len(r.suffix) || !strings.HasPrefix(value, r.prefix) || !strings.HasSuffix(value, r.suffix) {
+		return false
+	}
+	number, ok := parseSegmentNumber(value[len(r.prefix) : len(value)-len(r.suffix)])
+	return ok && number >= r.low && number <= r.high
+}
+
+// parseSegmentNumber parses a non-negative decimal without sign or leading zeros
+func parseSegmentNumber(text string) (uint64, bool) {
+	if text == "" || (len(text) > 1 && text[0] == '0') {
+		return 0, false
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] < '0' || text[i] > '9' {
+			return 0, false
+		}
+	}
+	number, err := strconv.ParseUint(text, 10, 64)
+	return number, err == nil
+}
+
+// MatchAttributesFunc is the casbin wrapper of MatchAttributes
+func MatchAttributesFunc(args ...interface{}) (interface{}, error) {
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return bool(MatchAttributes(name1, name2)), nil
+}
+
+// MatchAttributes matches objects identified by "," separated key=value attributes rather than a path. Every
+// attribute of pattern must be present in requested with the same value, requested may carry other attributes.
+// A value of "*" matches any value of the attribute, a pattern of "*" matches everything. Malformed attribute
+// strings never match.
+// For example - pattern = "team=payments,namespace=*" matches requested = "namespace=prod,team=payments" but not
+// "namespace=prod,team=billing" or "team=payments"
+func MatchAttributes(requested string, pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	requestedAttributes, ok := parseAttributes(requested)
+	if !ok {
+		return false
+	}
+	patternAttributes, ok := parseAttributes(pattern)
+	if !ok {
+		return false
+	}
+	for key, patternValue := range patternAttributes {
+		requestedValue, found := requestedAttributes[key]
+		if !found || (patternValue != "*" && patternValue != requestedValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAttributes splits "k1=v1,k2=v2" into its attributes, it fails for pairs without a key or value and for
+// repeated keys
+func parseAttributes(attributes string) (map[string]string, bool) {
+	parsed := make(map[string]string)
+	for _, pair := range strings.Split(attributes, ",") {
+		key, value, found := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !found || key == "" || value == "" {
+			return nil, false
+		}
+		if _, repeated := parsed[key]; repeated {
+			return nil, false
+		}
+		parsed[key] = value
+	}
+	return parsed, true
+}
+
+// Clock provides the current time to time dependent matchers, letting tests inject a fixed time
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewMatchTimeWindowFunc returns the casbin function for MatchTimeWindow. It is called either as
+// matchTimeWindow(p.window), evaluated at clock's current time, or as matchTimeWindow(r.now, p.window)
+// where r.now is a time.Time or an RFC3339 string
+func NewMatchTimeWindowFunc(clock Clock) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		now := clock.Now()
+		if len(args) == 2 {
+			switch requestTime := args[0].(type) {
+			case time.Time:
+				now = requestTime
+			case string:
+				parsedTime, err := time.Parse(time.RFC3339, requestTime)
+				if err != nil {
+					return false, err
+				}
+				now = parsedTime
+			default:
+				return false, fmt.Errorf("unsupported time %v for matchTimeWindow", args[0])
+			}
+		} else if len(args) != 1 {
+			return false, fmt.Errorf("matchTimeWindow expects 1 or 2 arguments, got %d", len(args))
+		}
+		windowSpec, ok := args[len(args)-1].(string)
+		if !ok {
+			return false, fmt.Errorf("unsupported window spec %v for matchTimeWindow", args[len(args)-1])
+		}
+		return MatchTimeWindow(now, windowSpec)
+	}
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// MatchTimeWindow checks whether now falls in any of the ";" separated windows of windowSpec. A window is
+// "HH:MM-HH:MM", optionally preceded by a day or day range, e.g. "mon-fri 09:00-18:00;sat 10:00-12:00".
+// Times are compared in now's location, a window ending before it starts spans midnight and belongs to the
+// day it starts on. windowSpec "*" matches any time
+func MatchTimeWindow(now time.Time, windowSpec string) (bool, error) {
+	if windowSpec == "*" {
+		return true, nil
+	}
+	minuteOfDay := now.Hour()*60 + now.Minute()
+	for _, window := range strings.Split(windowSpec, ";") {
+		window = strings.ToLower(strings.TrimSpace(window))
+		days := ""
+		if i := strings.Index(window, " "); i != -1 {
+			days, window = window[:i], strings.TrimSpace(window[i+1:])
+		}
+		times := strings.Split(window, "-")
+		if len(times) != 2 {
+			return false, fmt.Errorf("invalid time window %q", window)
+		}
+		start, err := parseMinuteOfDay(times[0])
+		if err != nil {
+			return false, err
+		}
+		end, err := parseMinuteOfDay(times[1])
+		if err != nil {
+			return false, err
+		}
+		day := now.Weekday()
+		inWindow := false
+		if start <= end {
+			inWindow = minuteOfDay >= start && minuteOfDay < end
+		} else if minuteOfDay >= start {
+			inWindow = true
+		} else if minuteOfDay < end {
+			// within the part after midnight, the window belongs to the previous day
+			inWindow = true
+			day = (day + 6) % 7
+		}
+		if !inWindow {
+			continue
+		}
+		dayMatched, err := matchWeekday(day, days)
+		if err != nil {
+			return false, err
+		}
+		if dayMatched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func parseMinuteOfDay(value string) (int, error) {
+	parsedTime, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q in time window", value)
+	}
+	return parsedTime.Hour()*60 + parsedTime.Minute(), nil
+}
+
+// matchWeekday checks day against a day ("mon") or a day range ("mon-fri", may wrap around the week), empty days
+// match every day
+func matchWeekday(day time.Weekday, days string) (bool, error) {
+	if days == "" {
+		return true, nil
+	}
+	dayRange := strings.Split(days, "-")
+	from, ok := weekdays[dayRange[0]]
+	if !ok || len(dayRange) > 2 {
+		return false, fmt.Errorf("invalid days %q in time window", days)
+	}
+	to := from
+	if len(dayRange) == 2 {
+		if to, ok = weekdays[dayRange[1]]; !ok {
+			return false, fmt.Errorf("invalid days %q in time window", days)
+		}
+	}
+	if from <= to {
+		return day >= from && day <= to, nil
+	}
+	return day >= from || day <= to, nil
+}
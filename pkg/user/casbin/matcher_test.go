@@ -0,0 +1,601 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchSubject(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		policy    string
+		want      bool
+	}{
+		{name: "wildcard subject", requested: "anyone@example.com", policy: "*", want: true},
+		{name: "other subject", requested: "anyone@example.com", policy: "user@example.com", want: false},
+		{name: "partial wildcard", requested: "user@example.com", policy: "user*", want: false},
+		{name: "empty subject", requested: "", policy: "*", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchSubject(tt.requested, tt.policy); got != tt.want {
+				t.Errorf("MatchSubject(%q, %q) = %v, want %v", tt.requested, tt.policy, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchSubjectEnforce(t *testing.T) {
+	enf, err := NewEnforcerWithEmbeddedModel(nil)
+	if err != nil {
+		t.Fatalf("NewEnforcerWithEmbeddedModel() error = %v", err)
+	}
+	enf.AddPolicy("*", "applications", "get", "public/*", "allow")
+	enf.AddPolicy("role:super-admin", "*", "*", "*", "allow")
+	enf.AddGroupingPolicy("admin", "role:super-admin")
+	enforcer := newTestEnforcerFor(t, false, enf)
+	if !enforcer.EnforceByEmail("anyone@example.com", "applications", "get", "public/app1") {
+		t.Errorf("EnforceByEmail of an arbitrary user on a \"*\" subject grant denied")
+	}
+	if enforcer.EnforceByEmail("anyone@example.com", "applications", "get", "team1/app1") {
+		t.Errorf("EnforceByEmail of an arbitrary user outside the \"*\" subject grant allowed")
+	}
+	if !enforcer.EnforceByEmail("admin", "applications", "delete", "team1/app1") {
+		t.Errorf("EnforceByEmail of admin denied")
+	}
+	if !enforcer.EnforceAsRoles("applications", "get", "public/app1", []string{"role:viewer"}) {
+		t.Errorf("EnforceAsRoles() on a \"*\" subject grant denied")
+	}
+}
+
+func TestMatchResourceHierarchy(t *testing.T) {
+	tests := []struct {
+		name          string
+		requestedPath string
+		policyPath    string
+		want          bool
+	}{
+		{name: "same path", requestedPath: "app/prod", policyPath: "app/prod", want: true},
+		{name: "child path", requestedPath: "app/prod/myapp", policyPath: "app/prod", want: true},
+		{name: "grandchild path", requestedPath: "app/prod/myapp/pod", policyPath: "app/prod", want: true},
+		{name: "sibling path", requestedPath: "app/staging", policyPath: "app/prod", want: false},
+		{name: "sibling child path", requestedPath: "app/staging/myapp", policyPath: "app/prod", want: false},
+		{name: "parent of policy", requestedPath: "app", policyPath: "app/prod", want: false},
+		{name: "wildcard segment", requestedPath: "app/prod/myapp", policyPath: "app/*", want: true},
+		{name: "empty wildcard segment", requestedPath: "app//myapp", policyPath: "app/*", want: false},
+		{name: "empty child segment", requestedPath: "app/prod/", policyPath: "app/prod", want: false},
+		{name: "wildcard segment within a rune", requestedPath: "app/\xa4", policyPath: "app/*", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchResourceHierarchy(tt.requestedPath, tt.policyPath); got != tt.want {
+				t.Errorf("MatchResourceHierarchy(%q, %q) = %v, want %v", tt.requestedPath, tt.policyPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchKeyByPartRecursive(t *testing.T) {
+	tests := []struct {
+		name string
+		key1 string
+		key2 string
+		want bool
+	}{
+		{name: "middle recursive with two segments", key1: "a/x/y/d", key2: "a/**/d", want: true},
+		{name: "middle recursive with one segment", key1: "a/x/d", key2: "a/**/d", want: true},
+		{name: "middle recursive with no segment", key1: "a/d", key2: "a/**/d", want: true},
+		{name: "middle recursive wrong suffix", key1: "a/x/y/e", key2: "a/**/d", want: false},
+		{name: "middle recursive wrong prefix", key1: "b/x/d", key2: "a/**/d", want: false},
+		{name: "only recursive", key1: "a/b/c", key2: "**", want: true},
+		{name: "only recursive single segment", key1: "a", key2: "**", want: true},
+		{name: "trailing recursive", key1: "a/b/c", key2: "a/**", want: true},
+		{name: "trailing recursive no segment", key1: "a", key2: "a/**", want: true},
+		{name: "trailing recursive other prefix", key1: "b/c", key2: "a/**", want: false},
+		{name: "multiple recursive", key1: "a/x/b/y/z/c", key2: "a/**/b/**/c", want: true},
+		{name: "multiple recursive missing middle", key1: "a/x/y/c", key2: "a/**/b/**/c", want: false},
+		{name: "recursive with prefix wildcard", key1: "a/x/dev-app", key2: "a/**/dev-*", want: true},
+		{name: "no recursive same as MatchKeyByPart", key1: "a/b/c", key2: "a/*/c", want: true},
+		{name: "empty segment not allowed", key1: "a//d", key2: "a/**/d", want: false},
+		{name: "empty segment not matched by wildcard", key1: "a//d", key2: "a/*/d", want: false},
+		{name: "empty segment after recursive", key1: "a/x//d", key2: "a/**/*/d", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchKeyByPartRecursive(tt.key1, tt.key2); got != tt.want {
+				t.Errorf("MatchKeyByPartRecursive(%q, %q) = %v, want %v", tt.key1, tt.key2, got, tt.want)
+			}
+		})
+	}
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestMatchKeyByPart(t *testing.T) {
+	tests := []struct {
+		name string
+		key1 string
+		key2 string
+		want bool
+	}{
+		{name: "exact", key1: "a/b/c", key2: "a/b/c", want: true},
+		{name: "wildcard segment", key1: "a/b/c", key2: "a/*/c", want: true},
+		{name: "wildcard segment other suffix", key1: "a/b/c", key2: "a/*/d", want: false},
+		{name: "prefix wildcard", key1: "a/bcd/c", key2: "a/bc*/c", want: true},
+		{name: "prefix wildcard equal to prefix", key1: "a/bc/c", key2: "a/bc*/c", want: true},
+		{name: "prefix wildcard other prefix", key1: "a/bd/c", key2: "a/bc*/c", want: false},
+		{name: "wildcard matches literal asterisk", key1: "a/*/c", key2: "a/*/c", want: true},
+		{name: "escaped asterisk matches literal asterisk", key1: "a/*/c", key2: `a/\*/c`, want: true},
+		{name: "escaped asterisk is not a wildcard", key1: "a/b/c", key2: `a/\*/c`, want: false},
+		{name: "escaped asterisk within segment", key1: "a/b*d/c", key2: `a/b\*d/c`, want: true},
+		{name: "escaped asterisk within segment other value", key1: "a/bxd/c", key2: `a/b\*d/c`, want: false},
+		{name: "escaped asterisk before wildcard", key1: "a/*-prod/c", key2: `a/\**/c`, want: true},
+		{name: "escaped asterisk before wildcard other value", key1: "a/x-prod/c", key2: `a/\**/c`, want: false},
+		{name: "backslash without asterisk", key1: `a/b\d/c`, key2: `a/b\d/c`, want: true},
+		{name: "super admin", key1: "a/b/c", key2: "*", want: true},
+		{name: "segment count differs", key1: "a/b", key2: "a/*/c", want: false},
+		{name: "empty segment", key1: "a//c", key2: "a/*/c", want: false},
+		{name: "empty keys", key1: "", key2: "", want: false},
+		{name: "wildcard beyond key length", key1: "a/b", key2: "a/bcdef*", want: false},
+		{name: "key equal to prefix before wildcard", key1: "a/bcdef", key2: "a/bcdef*", want: true},
+		{name: "suffix after wildcard is not checked", key1: "a/bx", key2: "a/b*c", want: true},
+		{name: "only wildcards", key1: "a/b", key2: "*/**", want: true},
+		{name: "trailing backslash", key1: `a/b\`, key2: `a/b\`, want: true},
+		{name: "trailing separator", key1: "a/b/", key2: "a/b/*", want: false},
+		{name: "multibyte prefix", key1: "a/caféteria", key2: "a/café*", want: true},
+		{name: "multibyte key equal to prefix", key1: "a/café", key2: "a/café*", want: true},
+		{name: "ascii prefix of multibyte key", key1: "a/café", key2: "a/caf*", want: true},
+		{name: "multibyte prefix other rune", key1: "a/cafeteria", key2: "a/café*", want: false},
+		{name: "multibyte prefix longer than key", key1: "a/caf", key2: "a/café*", want: false},
+		{name: "escaped multibyte prefix", key1: "a/*über", key2: `a/\*ü*`, want: true},
+		{name: "prefix within a rune", key1: "a/café", key2: "a/caf\xc3*", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchKeyByPart(tt.key1, tt.key2); got != tt.want {
+				t.Errorf("MatchKeyByPart(%q, %q) = %v, want %v", tt.key1, tt.key2, got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzMatchKeyByPart(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"a/b/c", "a/*/c"}, {"a/bcd/c", "a/bc*/c"}, {"a/b", "a/bcdef*"}, {"a/*/c", `a/\*/c`}, {"a/b", `a/\`},
+		{"*", "*"}, {"", ""}, {"a//c", "a/*/c"}, {"caf\u00e9teria", "caf\u00e9*"}, {"a/\xff", "a/\xff*"},
+		{"a/\xa4/c", "a/*/c"}, {"a//build1", "a/*/build[1-2]"}, {"a/build1", "a/build[1-2]"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+	f.Fuzz(func(t *testing.T, key1 string, key2 string) {
+		matched := MatchKeyByPart(key1, key2)
+		if key2 == "*" {
+			if !matched {
+				t.Errorf("MatchKeyByPart(%q, \"*\") = false", key1)
+			}
+			return
+		}
+		if matched && strings.Count(key1, "/") != strings.Count(key2, "/") {
+			t.Errorf("MatchKeyByPart(%q, %q) matched a different number of segments", key1, key2)
+		}
+		if !strings.Contains(key2, "[") && MatchKeyByPartRange(key1, key2) != matched {
+			t.Errorf("MatchKeyByPartRange(%q, %q) = %v without ranges, MatchKeyByPart = %v", key1, key2, !matched, matched)
+		}
+		if !containsSegment(key2, "**") && MatchKeyByPartRecursive(key1, key2) != matched {
+			t.Errorf("MatchKeyByPartRecursive(%q, %q) = %v without \"**\" segments, MatchKeyByPart = %v", key1, key2, !matched, matched)
+		}
+		if !strings.Contains(key1, `\`) && !strings.Contains(key1, "//") && key1 != "" &&
+			!strings.HasPrefix(key1, "/") && !strings.HasSuffix(key1, "/") && !MatchKeyByPart(key1, key1) {
+			t.Errorf("MatchKeyByPart(%q, %q) = false, a key matches itself", key1, key1)
+		}
+	})
+}
+
+// containsSegment tells whether segment is one of the "/" separated segments of key
+func containsSegment(key string, segment string) bool {
+	for _, val := range strings.Split(key, "/") {
+		if val == segment {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMatchKeyByPartSep(t *testing.T) {
+	matchByColon := MatchKeyByPartSep(":")
+	tests := []struct {
+		name string
+		key1 string
+		key2 string
+		want bool
+	}{
+		{name: "exact arn", key1: "arn:aws:s3:eu-west-1:bucket", key2: "arn:aws:s3:eu-west-1:bucket", want: true},
+		{name: "wildcard part", key1: "arn:aws:s3:eu-west-1:bucket", key2: "arn:aws:s3:*:bucket", want: true},
+		{name: "prefix wildcard part", key1: "arn:aws:s3:eu-west-1:bucket", key2: "arn:aws:s3:eu-*:bucket", want: true},
+		{name: "other part", key1: "arn:aws:ec2:eu-west-1:bucket", key2: "arn:aws:s3:*:bucket", want: false},
+		{name: "part count differs", key1: "arn:aws:s3:bucket", key2: "arn:aws:s3:*:bucket", want: false},
+		{name: "slash within a part", key1: "arn:aws:s3:team/app", key2: "arn:aws:s3:*", want: true},
+		{name: "empty part not allowed", key1: "arn::s3:x:bucket", key2: "arn:*:s3:x:bucket", want: false},
+		{name: "super admin", key1: "arn:aws:s3:eu-west-1:bucket", key2: "*", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchByColon(tt.key1, tt.key2)
+			if err != nil || got != tt.want {
+				t.Errorf("MatchKeyByPartSep(\":\")(%q, %q) = %v, %v, want %v", tt.key1, tt.key2, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchKeyByPartSepEnforce(t *testing.T) {
+	const arnModel = `
+[request_definition]
+r = sub, res, act, obj
+
+[policy_definition]
+p = sub, res, act, obj, eft
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[role_definition]
+g = _, _
+
+[matchers]
+m = g(r.sub, p.sub) && matchKeyByPart(r.res, p.res) && matchKeyByPart(r.act, p.act) && matchKeyByColon(r.obj, p.obj)
+`
+	enf := newTestCasbinEnforcerWithModel(arnModel, map[string]matcherFunc{"matchKeyByColon": MatchKeyByPartSep(":")},
+		[][]string{{"user@example.com", "bucket", "get", "arn:aws:s3:*:logs-*", "allow"}}, nil)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	if !enforcer.EnforceByEmail("user@example.com", "bucket", "get", "arn:aws:s3:eu-west-1:logs-prod") {
+		t.Errorf("EnforceByEmail of matching arn denied")
+	}
+	if enforcer.EnforceByEmail("user@example.com", "bucket", "get", "arn:aws:s3:eu-west-1:data-prod") {
+		t.Errorf("EnforceByEmail of non matching arn allowed")
+	}
+}
+
+func TestMatchKeyByPartAny(t *testing.T) {
+	tests := []struct {
+		name string
+		key1 string
+		key2 string
+		want bool
+	}{
+		{name: "single object", key1: "team1/app1", key2: "team1/app1", want: true},
+		{name: "first of several", key1: "team1/app1", key2: "team1/app1,team2/app2,team3/app3", want: true},
+		{name: "last of several", key1: "team3/app3", key2: "team1/app1,team2/app2,team3/app3", want: true},
+		{name: "wildcard alternative", key1: "team2/app9", key2: "team1/app1,team2/*", want: true},
+		{name: "spaces around alternatives", key1: "team2/app2", key2: "team1/app1 , team2/app2", want: true},
+		{name: "none of several", key1: "team1/app2", key2: "team1/app1,team2/*", want: false},
+		{name: "empty alternatives", key1: "team1/app1", key2: ",,", want: false},
+		{name: "whole list is not an object", key1: "team1/app1,team2/app2", key2: "team1/app1,team2/app2", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchKeyByPartAny(tt.key1, tt.key2); got != tt.want {
+				t.Errorf("MatchKeyByPartAny(%q, %q) = %v, want %v", tt.key1, tt.key2, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchKeyByPartAnyEnforce(t *testing.T) {
+	const anyObjectModel = `
+[request_definition]
+r = sub, res, act, obj
+
+[policy_definition]
+p = sub, res, act, obj, eft
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[role_definition]
+g = _, _
+
+[matchers]
+m = g(r.sub, p.sub) && matchKeyByPart(r.res, p.res) && matchKeyByPart(r.act, p.act) && matchKeyByPartAny(r.obj, p.obj)
+`
+	enf := newTestCasbinEnforcerWithModel(anyObjectModel, map[string]matcherFunc{"matchKeyByPartAny": MatchKeyByPartAnyFunc},
+		[][]string{{"user@example.com", "applications", "get", "team1/app1,team2/*", "allow"}}, nil)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	got := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1", "team2/app5", "team1/app2"})
+	want := map[string]bool{"team1/app1": true, "team2/app5": true, "team1/app2": false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EnforceByEmailInBatch() = %v, want %v", got, want)
+	}
+}
+
+func TestMatchKeyByPartOr(t *testing.T) {
+	tests := []struct {
+		name string
+		key1 string
+		key2 string
+		want bool
+	}{
+		{name: "first alternative", key1: "app/prod/web", key2: "app/prod/*|app/staging/*", want: true},
+		{name: "second alternative", key1: "app/staging/web", key2: "app/prod/*|app/staging/*", want: true},
+		{name: "no alternative", key1: "app/dev/web", key2: "app/prod/*|app/staging/*", want: false},
+		{name: "alternatives of other segment counts", key1: "app/web", key2: "app/prod/*|app/*", want: true},
+		{name: "empty alternatives", key1: "app/prod/web", key2: "||", want: false},
+		{name: "single pattern", key1: "app/prod/web", key2: "app/prod/*", want: true},
+		{name: "single pattern not matching", key1: "app/dev/web", key2: "app/prod/*", want: false},
+		{name: "super admin", key1: "app/dev/web", key2: "*", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchKeyByPartOr(tt.key1, tt.key2); got != tt.want {
+				t.Errorf("MatchKeyByPartOr(%q, %q) = %v, want %v", tt.key1, tt.key2, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchKeyByPartOrEnforce(t *testing.T) {
+	const orModel = `
+[request_definition]
+r = sub, res, act, obj
+
+[policy_definition]
+p = sub, res, act, obj, eft
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[role_definition]
+g = _, _
+
+[matchers]
+m = g(r.sub, p.sub) && matchKeyByPart(r.res, p.res) && matchKeyByPart(r.act, p.act) && matchKeyByPartOr(r.obj, p.obj)
+`
+	enf := newTestCasbinEnforcerWithModel(orModel, map[string]matcherFunc{"matchKeyByPartOr": MatchKeyByPartOrFunc},
+		[][]string{{"user@example.com", "applications", "get", "app/prod/*|app/staging/*", "allow"}}, nil)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	got := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"app/prod/web", "app/staging/web", "app/dev/web"})
+	want := map[string]bool{"app/prod/web": true, "app/staging/web": true, "app/dev/web": false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EnforceByEmailInBatch() = %v, want %v", got, want)
+	}
+}
+
+func TestMatchKeyByPartRange(t *testing.T) {
+	tests := []struct {
+		name string
+		key1 string
+		key2 string
+		want bool
+	}{
+		{name: "in range", key1: "team1/build42", key2: "team1/build[1-100]", want: true},
+		{name: "lower bound", key1: "team1/build1", key2: "team1/build[1-100]", want: true},
+		{name: "upper bound", key1: "team1/build100", key2: "team1/build[1-100]", want: true},
+		{name: "below range", key1: "team1/build0", key2: "team1/build[1-100]", want: false},
+		{name: "above range", key1: "team1/build101", key2: "team1/build[1-100]", want: false},
+		{name: "suffix", key1: "team1/build42-prod", key2: "team1/build[1-100]-prod", want: true},
+		{name: "other suffix", key1: "team1/build42-dev", key2: "team1/build[1-100]-prod", want: false},
+		{name: "range only", key1: "team1/7", key2: "team1/[0-9]", want: true},
+		{name: "non numeric", key1: "team1/buildx", key2: "team1/build[1-100]", want: false},
+		{name: "no number", key1: "team1/build", key2: "team1/build[1-100]", want: false},
+		{name: "signed number", key1: "team1/build+4", key2: "team1/build[1-100]", want: false},
+		{name: "leading zero", key1: "team1/build042", key2: "team1/build[1-100]", want: false},
+		{name: "overflowing number", key1: "team1/build99999999999999999999", key2: "team1/build[1-100]", want: false},
+		{name: "prefix and suffix overlap", key1: "team1/ab", key2: "team1/ab[1-2]b", want: false},
+		{name: "wildcard alongside range", key1: "team1/build42", key2: "*/build[1-100]", want: true},
+		{name: "malformed range is literal", key1: "team1/build[1-x]", key2: "team1/build[1-x]", want: true},
+		{name: "reversed range is literal", key1: "team1/build5", key2: "team1/build[9-1]", want: false},
+		{name: "segment count differs", key1: "team1/build42/x", key2: "team1/build[1-100]", want: false},
+		{name: "super admin", key1: "team1/build42", key2: "*", want: true},
+		{name: "empty segment not matched by wildcard", key1: "team1//build42", key2: "team1/*/build[1-100]", want: false},
+		{name: "empty segment not matched by range", key1: "team1/", key2: "team1/[0-9]", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchKeyByPartRange(tt.key1, tt.key2); got != tt.want {
+				t.Errorf("MatchKeyByPartRange(%q, %q) = %v, want %v", tt.key1, tt.key2, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentRangesBounded(t *testing.T) {
+	for i := 0; i < maxSegmentRanges+10; i++ {
+		segment := fmt.Sprintf("build[%d-%d]", i, i+1)
+		if !MatchKeyByPartRange(fmt.Sprintf("team1/build%d", i+1), "team1/"+segment) {
+			t.Fatalf("MatchKeyByPartRange() of segment %s denied", segment)
+		}
+	}
+	cached := 0
+	segmentRanges.Range(func(key, value interface{}) bool {
+		cached++
+		return true
+	})
+	if cached > maxSegmentRanges {
+		t.Errorf("segment ranges cached = %d, want at most %d", cached, maxSegmentRanges)
+	}
+}
+
+func TestMatchKeyByPartRangeEnforce(t *testing.T) {
+	const rangeModel = `
+[request_definition]
+r = sub, res, act, obj
+
+[policy_definition]
+p = sub, res, act, obj, eft
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[role_definition]
+g = _, _
+
+[matchers]
+m = g(r.sub, p.sub) && matchKeyByPart(r.res, p.res) && matchKeyByPart(r.act, p.act) && matchKeyByPartRange(r.obj, p.obj)
+`
+	enf := newTestCasbinEnforcerWithModel(rangeModel, map[string]matcherFunc{"matchKeyByPartRange": MatchKeyByPartRangeFunc},
+		[][]string{{"user@example.com", "applications", "get", "team1/build[1-100]", "allow"}}, nil)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	got := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/build42", "team1/build101", "team1/buildx"})
+	want := map[string]bool{"team1/build42": true, "team1/build101": false, "team1/buildx": false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EnforceByEmailInBatch() = %v, want %v", got, want)
+	}
+}
+
+func TestMatchAttributes(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		pattern   string
+		want      bool
+	}{
+		{name: "same attributes", requested: "namespace=prod,team=payments", pattern: "namespace=prod,team=payments", want: true},
+		{name: "attributes in another order", requested: "team=payments,namespace=prod", pattern: "namespace=prod,team=payments", want: true},
+		{name: "value wildcard", requested: "namespace=prod,team=payments", pattern: "namespace=*,team=payments", want: true},
+		{name: "extra requested attribute", requested: "namespace=prod,team=payments", pattern: "team=payments", want: true},
+		{name: "spaces around pairs", requested: " namespace = prod , team=payments", pattern: "team=payments", want: true},
+		{name: "other value", requested: "namespace=prod,team=billing", pattern: "namespace=*,team=payments", want: false},
+		{name: "missing attribute", requested: "team=payments", pattern: "namespace=*,team=payments", want: false},
+		{name: "wildcard pattern", requested: "team=payments", pattern: "*", want: true},
+		{name: "malformed requested", requested: "team", pattern: "team=*", want: false},
+		{name: "empty requested value", requested: "team=", pattern: "team=*", want: false},
+		{name: "repeated requested key", requested: "team=billing,team=payments", pattern: "team=payments", want: false},
+		{name: "malformed pattern", requested: "team=payments", pattern: "team=payments,", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchAttributes(tt.requested, tt.pattern); got != tt.want {
+				t.Errorf("MatchAttributes(%q, %q) = %v, want %v", tt.requested, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchAttributesEnforce(t *testing.T) {
+	const attributesModel = `
+[request_definition]
+r = sub, res, act, obj
+
+[policy_definition]
+p = sub, res, act, obj, eft
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[role_definition]
+g = _, _
+
+[matchers]
+m = g(r.sub, p.sub) && matchKeyByPart(r.res, p.res) && matchKeyByPart(r.act, p.act) && matchAttributes(r.obj, p.obj)
+`
+	enf := newTestCasbinEnforcerWithModel(attributesModel, map[string]matcherFunc{"matchAttributes": MatchAttributesFunc},
+		[][]string{{"user@example.com", "namespace", "get", "team=payments,namespace=*", "allow"}}, nil)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	if !enforcer.EnforceByEmail("user@example.com", "namespace", "get", "namespace=prod,team=payments") {
+		t.Errorf("EnforceByEmail of matching attributes denied")
+	}
+	if enforcer.EnforceByEmail("user@example.com", "namespace", "get", "namespace=prod,team=billing") {
+		t.Errorf("EnforceByEmail of non matching attributes allowed")
+	}
+}
+
+func TestMatchTimeWindow(t *testing.T) {
+	// 2026-10-14 is a wednesday
+	at := func(value string) time.Time {
+		parsedTime, _ := time.Parse("2006-01-02 15:04", value)
+		return parsedTime
+	}
+	tests := []struct {
+		name       string
+		now        time.Time
+		windowSpec string
+		want       bool
+		wantErr    bool
+	}{
+		{name: "inside business hours", now: at("2026-10-14 10:30"), windowSpec: "09:00-18:00", want: true},
+		{name: "at window start", now: at("2026-10-14 09:00"), windowSpec: "09:00-18:00", want: true},
+		{name: "at window end", now: at("2026-10-14 18:00"), windowSpec: "09:00-18:00", want: false},
+		{name: "before business hours", now: at("2026-10-14 08:59"), windowSpec: "09:00-18:00", want: false},
+		{name: "weekday range inside", now: at("2026-10-14 10:30"), windowSpec: "mon-fri 09:00-18:00", want: true},
+		{name: "weekday range on weekend", now: at("2026-10-17 10:30"), windowSpec: "mon-fri 09:00-18:00", want: false},
+		{name: "second window matches", now: at("2026-10-17 11:00"), windowSpec: "mon-fri 09:00-18:00;sat 10:00-12:00", want: true},
+		{name: "overnight window before midnight", now: at("2026-10-17 23:00"), windowSpec: "sat 22:00-02:00", want: true},
+		{name: "overnight window after midnight", now: at("2026-10-18 01:00"), windowSpec: "sat 22:00-02:00", want: true},
+		{name: "overnight window after midnight of other day", now: at("2026-10-17 01:00"), windowSpec: "sat 22:00-02:00", want: false},
+		{name: "wrapping day range", now: at("2026-10-18 10:00"), windowSpec: "sat-sun 09:00-18:00", want: true},
+		{name: "any time", now: at("2026-10-18 03:00"), windowSpec: "*", want: true},
+		{name: "invalid time", now: at("2026-10-14 10:30"), windowSpec: "9am-6pm", wantErr: true},
+		{name: "invalid day", now: at("2026-10-14 10:30"), windowSpec: "someday 09:00-18:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MatchTimeWindow(tt.now, tt.windowSpec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MatchTimeWindow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("MatchTimeWindow(%v, %q) = %v, want %v", tt.now, tt.windowSpec, got, tt.want)
+			}
+		})
+	}
+}
+
+const timeWindowModel = `
+[request_definition]
+r = sub, res, act, obj
+
+[policy_definition]
+p = sub, res, act, obj, window, eft
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[role_definition]
+g = _, _
+
+[matchers]
+m = g(r.sub, p.sub) && matchKeyByPart(r.res, p.res) && matchKeyByPart(r.act, p.act) && matchKeyByPart(r.obj, p.obj) && matchTimeWindow(p.window)
+`
+
+func TestMatchTimeWindowEnforce(t *testing.T) {
+	clock := &fakeClock{}
+	enf := newTestCasbinEnforcerWithModel(timeWindowModel, map[string]matcherFunc{"matchTimeWindow": NewMatchTimeWindowFunc(clock)},
+		[][]string{{"user@example.com", "applications", "trigger", "team1/*", "mon-fri 09:00-18:00", "allow"}}, nil)
+	enforcer := newTestEnforcerFor(t, false, enf)
+
+	clock.now = time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	if !enforcer.EnforceByEmail("user@example.com", "applications", "trigger", "team1/app1") {
+		t.Errorf("EnforceByEmail() in window = false, want true")
+	}
+	clock.now = time.Date(2026, 10, 14, 20, 0, 0, 0, time.UTC)
+	if enforcer.EnforceByEmail("user@example.com", "applications", "trigger", "team1/app1") {
+		t.Errorf("EnforceByEmail() out of window = true, want false")
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	_ "embed"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/casbin/casbin"
+	"github.com/casbin/casbin/model"
+	"github.com/casbin/casbin/persist"
+)
+
+// DefaultModel is the predefined RBAC model, same as the auth_model.conf shipped next to the binary and read by Create
+//
+//go:embed auth_model.conf
+var DefaultModel string
+
+// defaultModel is DefaultModel parsed once, against which runsDefaultModel compares the model of an enforcer
+var defaultModel = casbin.NewModel(DefaultModel)
+
+// NewEnforcerWithEmbeddedModel builds a casbin enforcer on DefaultModel with the package's matchers registered,
+// policies are loaded from adapter, which may be nil for an enforcer whose policies are added programmatically
+func NewEnforcerWithEmbeddedModel(adapter persist.Adapter) (*casbin.Enforcer, error) {
+	params := []interface{}{casbin.NewModel(DefaultModel)}
+	if adapter != nil {
+		params = append(params, adapter)
+	}
+	enforcer, err := casbin.NewEnforcerSafe(params...)
+	if err != nil {
+		return nil, err
+	}
+	addMatcherFunctions(enforcer)
+	return enforcer, nil
+}
+
+// addMatcherFunctions registers the custom matchers used by models of this package
+func addMatcherFunctions(enforcer *casbin.Enforcer) {
+	enforcer.AddFunction("matchKeyByPart", MatchKeyByPartFunc)
+	enforcer.AddFunction("matchSubject", MatchSubjectFunc)
+	enforcer.AddFunction("matchResourceHierarchy", MatchResourceHierarchyFunc)
+	enforcer.AddFunction("matchKeyByPartRecursive", MatchKeyByPartRecursiveFunc)
+	enforcer.AddFunction("matchKeyByPartAny", MatchKeyByPartAnyFunc)
+	enforcer.AddFunction("matchKeyByPartOr", MatchKeyByPartOrFunc)
+	enforcer.AddFunction("matchKeyByPartRange", MatchKeyByPartRangeFunc)
+	enforcer.AddFunction("matchAttributes", MatchAttributesFunc)
+	enforcer.AddFunction("matchTimeWindow", NewMatchTimeWindowFunc(realClock{}))
+}
+
+// runsDefaultModel tells whether enforcer runs DefaultModel with the package's matchers, so that callers may rely on
+// its semantics, e.g. that a grant of "*" action and object can only be narrowed by a deny policy
+func runsDefaultModel(enforcer *casbin.Enforcer) bool {
+	live := enforcer.GetModel()
+	if len(live) != len(defaultModel) {
+		return false
+	}
+	for sec, assertions := range defaultModel {
+		if len(live[sec]) != len(assertions) {
+			return false
+		}
+		for key, assertion := range assertions {
+			if ast, found := live[sec][key]; !found || ast.Value != assertion.Value {
+				return false
+			}
+		}
+	}
+	functions, err := registeredFunctions(enforcer)
+	if err != nil {
+		return false
+	}
+	return sameFunction(functions["matchKeyByPart"], MatchKeyByPartFunc) && sameFunction(functions["matchSubject"], MatchSubjectFunc)
+}
+
+// sameFunction tells whether registered is function
+func sameFunction(registered func(args ...interface{}) (interface{}, error), function func(args ...interface{}) (interface{}, error)) bool {
+	return registered != nil && reflect.ValueOf(registered).Pointer() == reflect.ValueOf(function).Pointer()
+}
+
+// registeredFunctions returns the functions registered on enforcer. casbin neither exposes them nor lets a model be
+// set without resetting them, so they are read from the enforcer's unexported function map
+func registeredFunctions(enforcer *casbin.Enforcer) (model.FunctionMap, error) {
+	field := reflect.ValueOf(enforcer).Elem().FieldByName("fm")
+	if !field.IsValid() || field.Type() != reflect.TypeOf(model.FunctionMap{}) {
+		return nil, fmt.Errorf("casbin enforcer has no function map")
+	}
+	return *(*model.FunctionMap)(unsafe.Pointer(field.UnsafeAddr())), nil
+}
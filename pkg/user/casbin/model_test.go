@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	fileadapter "github.com/casbin/casbin/persist/file-adapter"
+)
+
+func TestNewEnforcerWithEmbeddedModel(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.csv")
+	policies := "p, user@example.com, applications, get, team1/*, allow\n" +
+		"p, role:team3-admin, applications, *, team3/*, allow\n" +
+		"g, user@example.com, role:team3-admin\n"
+	if err := os.WriteFile(policyFile, []byte(policies), 0600); err != nil {
+		t.Fatalf("error in writing policy file: %v", err)
+	}
+	enf, err := NewEnforcerWithEmbeddedModel(fileadapter.NewAdapter(policyFile))
+	if err != nil {
+		t.Fatalf("NewEnforcerWithEmbeddedModel() = %v", err)
+	}
+	enforcer := newTestEnforcerFor(t, false, enf)
+	tests := []struct {
+		action string
+		object string
+		want   bool
+	}{
+		{action: "get", object: "team1/app1", want: true},
+		{action: "delete", object: "team1/app1", want: false},
+		{action: "delete", object: "team3/app1", want: true},
+		{action: "get", object: "team2/app1", want: false},
+	}
+	for _, tt := range tests {
+		if got := enforcer.EnforceByEmail("user@example.com", "applications", tt.action, tt.object); got != tt.want {
+			t.Errorf("EnforceByEmail(%s, %s) = %v, want %v", tt.action, tt.object, got, tt.want)
+		}
+	}
+
+	empty, err := NewEnforcerWithEmbeddedModel(nil)
+	if err != nil {
+		t.Fatalf("NewEnforcerWithEmbeddedModel(nil) = %v", err)
+	}
+	empty.AddPolicy("user@example.com", "applications", "get", "team1/*", "allow")
+	if !newTestEnforcerFor(t, false, empty).EnforceByEmail("user@example.com", "applications", "get", "team1/app1") {
+		t.Errorf("EnforceByEmail against programmatic policy denied")
+	}
+}
+
+func TestDefaultModelMatchesShippedModel(t *testing.T) {
+	shipped, err := os.ReadFile("../../../auth_model.conf")
+	if err != nil {
+		t.Skipf("shipped model not found: %v", err)
+	}
+	if string(shipped) != DefaultModel {
+		t.Errorf("embedded model differs from auth_model.conf at the repository root")
+	}
+}
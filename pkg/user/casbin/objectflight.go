@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"context"
+	"sync"
+)
+
+// objectFlight is the evaluation of a single batch object, shared by the overlapping batches requesting it
+type objectFlight struct {
+	done    chan struct{}
+	allowed bool
+	err     error
+}
+
+// objectFlights holds the object evaluations of running batches, keyed by getObjectFlightKey. A flight is kept
+// after it is done, until a batch holding its result stores it in the cache
+type objectFlights struct {
+	mutex   sync.Mutex
+	flights map[string]*objectFlight
+}
+
+func getObjectFlightKey(emailId string, resource string, action string, object string) string {
+	return emailId + "$$" + getCacheKey("", resource, action) + "$$" + object
+}
+
+// enforceObjectShared evaluates object unless another batch evaluated or is evaluating it, in which case its
+// result is reused. done is false when ctx ended while waiting for another batch's evaluation
+func (e *EnforcerImpl) enforceObjectShared(ctx context.Context, emailId string, resource string, action string, object string) (allowed bool, done bool, err error) {
+	key := getObjectFlightKey(emailId, resource, action, object)
+	e.objectFlights.mutex.Lock()
+	flight, found := e.objectFlights.flights[key]
+	if !found {
+		// the batch which evaluated object may have stored and released it since this batch read the cache
+		if decision := getCachedDecision(e, emailId, resource, action, object); decision.known() {
+			e.objectFlights.mutex.Unlock()
+			return decision.allowed(), true, nil
+		}
+		flight = &objectFlight{done: make(chan struct{})}
+		if e.objectFlights.flights == nil {
+			e.objectFlights.flights = make(map[string]*objectFlight)
+		}
+		e.objectFlights.flights[key] = flight
+		e.objectFlights.mutex.Unlock()
+		flight.allowed, flight.err = e.enforceObjectWithRetry(ctx, emailId, resource, action, object)
+		close(flight.done)
+		return flight.allowed, true, flight.err
+	}
+	e.objectFlights.mutex.Unlock()
+	select {
+	case <-flight.done:
+		return flight.allowed, true, flight.err
+	case <-ctx.Done():
+		return false, false, nil
+	}
+}
+
+// releaseObjectFlights drops the finished flights of vals once their results are stored in the cache, failed
+// evaluations are dropped too so later batches evaluate them again
+func (e *EnforcerImpl) releaseObjectFlights(emailId string, resource string, action string, vals []string) {
+	e.objectFlights.mutex.Lock()
+	defer e.objectFlights.mutex.Unlock()
+	for _, object := range vals {
+		key := getObjectFlightKey(emailId, resource, action, object)
+		flight, found := e.objectFlights.flights[key]
+		if !found {
+			continue
+		}
+		select {
+		case <-flight.done:
+			delete(e.objectFlights.flights, key)
+		default:
+		}
+	}
+}
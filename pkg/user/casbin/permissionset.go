@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// PermissionSet is a snapshot of the policies applying to a subject, answering Allowed without evaluating casbin.
+// It is stale once the policies are reloaded or any cache entry is invalidated, Allowed then falls back to
+// EnforceByEmail. Policies are matched the way auth_model.conf does
+type PermissionSet struct {
+	enforcer      *EnforcerImpl
+	subject       string
+	generation    uint64
+	invalidations uint64
+	// decided and allowed hold the outcome of the principal lists
+	decided bool
+	allowed bool
+	// policies of the subject, its roles and "*", and those of ENFORCER_DEFAULT_ROLE
+	policies            [][]string
+	defaultRolePolicies [][]string
+	impliedBy           map[string][]string
+}
+
+// BuildPermissionSet collects the policies applying to email, for sessions whose permissions are checked on hot paths
+func (e *EnforcerImpl) BuildPermissionSet(email string) PermissionSet {
+	subject := strings.ToLower(email)
+	set := PermissionSet{enforcer: e, subject: subject, generation: e.PolicyGeneration(),
+		invalidations: atomic.LoadUint64(&e.invalidations)}
+	set.allowed, set.decided = e.normalizedPrincipalDecision(subject)
+	if set.decided {
+		return set
+	}
+	set.policies = e.policiesApplyingTo(subject)
+	if defaultRole := e.config.DefaultRole; defaultRole != "" {
+		set.defaultRolePolicies = e.policiesApplyingTo(defaultRole)
+	}
+	e.actions.mutex.RLock()
+	set.impliedBy = e.actions.impliedBy
+	e.actions.mutex.RUnlock()
+	return set
+}
+
+// policiesApplyingTo returns copies of the policies of subject, of its implicit roles and of "*"
+func (e *EnforcerImpl) policiesApplyingTo(subject string) [][]string {
+	var policies [][]string
+	for _, candidate := range append(append([]string{subject}, e.Enforcer.GetImplicitRolesForUser(subject)...), "*") {
+		for _, policy := range e.Enforcer.GetFilteredPolicy(0, candidate) {
+			if len(policy) >= 5 {
+				policies = append(policies, append([]string{}, policy...))
+			}
+		}
+	}
+	return policies
+}
+
+// Stale tells whether the policies or cached decisions changed since the set was built
+func (s PermissionSet) Stale() bool {
+	return s.enforcer == nil || s.generation != s.enforcer.PolicyGeneration() ||
+		s.invalidations != atomic.LoadUint64(&s.enforcer.invalidations)
+}
+
+// Allowed decides resource, action and object for the subject of the set, as EnforceByEmail would
+func (s PermissionSet) Allowed(resource string, action string, object string) bool {
+	if s.Stale() {
+		if s.enforcer == nil {
+			return false
+		}
+		return s.enforcer.EnforceByEmail(s.subject, resource, action, object)
+	}
+	if s.decided {
+		return s.allowed
+	}
+	if s.allowedBy(s.policies, resource, action, object) {
+		return true
+	}
+	// as enforcePolicy does, a deny of the subject's request wins over the default role
+	if _, denied := effectOf(s.policies, resource, action, object); denied || s.defaultRolePolicies == nil {
+		return false
+	}
+	return s.allowedBy(s.defaultRolePolicies, resource, action, object)
+}
+
+// allowedBy evaluates the deny override effect over policies for action and, as enforceActions does, only when
+// action is denied for lack of a grant, for each action granting it
+func (s PermissionSet) allowedBy(policies [][]string, resource string, action string, object string) bool {
+	allowed, denied := effectOf(policies, resource, action, object)
+	if allowed || denied {
+		return allowed
+	}
+	for _, candidate := range s.impliedBy[strings.ToLower(action)] {
+		if allowed, _ := effectOf(policies, resource, candidate, object); allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// effectOf evaluates the deny override effect over the policies matching resource, action and object, allowed
+// is false whenever denied is true
+func effectOf(policies [][]string, resource string, action string, object string) (allowed bool, denied bool) {
+	for _, policy := range policies {
+		if !matchesPolicy(policy, resource, []string{action}, object) {
+			continue
+		}
+		if policy[4] == "deny" {
+			return false, true
+		}
+		allowed = allowed || policy[4] == "allow"
+	}
+	return allowed, false
+}
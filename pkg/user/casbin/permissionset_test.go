@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"testing"
+)
+
+func TestBuildPermissionSet(t *testing.T) {
+	t.Setenv("ENFORCER_DEFAULT_ROLE", "role:default")
+	policies := append([][]string{
+		{"role:viewer", "environment", "get", "*", "allow"},
+		{"*", "applications", "get", "public/*", "allow"},
+		{"role:default", "applications", "get", "shared/*", "allow"},
+		{"user@example.com", "applications", "*", "team3/secret", "deny"},
+		{"user@example.com", "applications", "admin", "team5/*", "allow"},
+	}, testPolicies...)
+	groupings := append([][]string{{"role:team3-admin", "role:viewer"}}, testGroupings...)
+	enf := newTestCasbinEnforcerWithModel(DefaultModel, map[string]matcherFunc{"matchSubject": MatchSubjectFunc}, policies, groupings)
+	enforcer := newTestEnforcerFor(t, true, enf)
+	enforcer.SetActionInheritance(map[string][]string{"admin": {"get", "delete"}})
+
+	set := enforcer.BuildPermissionSet("User@example.com")
+	if set.Stale() {
+		t.Fatalf("Stale() of a new permission set = true")
+	}
+	for _, resource := range []string{"applications", "environment"} {
+		for _, action := range []string{"get", "delete", "admin"} {
+			for _, object := range []string{"team1/app1", "team2/app1", "team3/app1", "team3/secret", "team4/app1",
+				"team5/app1", "public/app1", "shared/app1", "env1/app1"} {
+				want := enforcer.EnforceByEmail("user@example.com", resource, action, object)
+				if got := set.Allowed(resource, action, object); got != want {
+					t.Errorf("Allowed(%s, %s, %s) = %v, want %v", resource, action, object, got, want)
+				}
+			}
+		}
+	}
+
+	enforcer.SetPrincipalDenyList([]string{"user@example.com"})
+	if !set.Stale() {
+		t.Errorf("Stale() after a principal list change = false")
+	}
+	if set.Allowed("applications", "get", "team1/app1") {
+		t.Errorf("Allowed() of a stale set ignored the changed policies")
+	}
+	if denied := enforcer.BuildPermissionSet("user@example.com"); denied.Allowed("applications", "get", "team1/app1") {
+		t.Errorf("Allowed() of a denied principal = true")
+	}
+}
+
+func TestPermissionSetDenies(t *testing.T) {
+	t.Setenv("ENFORCER_DEFAULT_ROLE", "role:default")
+	policies := [][]string{
+		{"user@example.com", "applications", "view", "team1/a", "deny"},
+		{"user@example.com", "applications", "manage", "team1/*", "allow"},
+		{"user@example.com", "applications", "get", "team1/a", "deny"},
+		{"role:default", "applications", "*", "*", "allow"},
+	}
+	enforcer := newTestEnforcer(t, true, policies, nil)
+	enforcer.SetActionInheritance(map[string][]string{"manage": {"view"}})
+	set := enforcer.BuildPermissionSet("user@example.com")
+	tests := []struct {
+		name   string
+		action string
+		object string
+		want   bool
+	}{
+		{name: "deny of the requested action over a granting action", action: "view", object: "team1/a"},
+		{name: "granting action without a deny", action: "view", object: "team1/b", want: true},
+		{name: "deny of the subject over the default role", action: "get", object: "team1/a"},
+		{name: "default role without a deny", action: "get", object: "team2/a", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := enforcer.EnforceByEmail("user@example.com", "applications", tt.action, tt.object)
+			if got := set.Allowed("applications", tt.action, tt.object); got != live || got != tt.want {
+				t.Errorf("Allowed() = %v, EnforceByEmail() = %v, want %v", got, live, tt.want)
+			}
+		})
+	}
+}
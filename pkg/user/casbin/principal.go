@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"strings"
+	"sync"
+)
+
+// principalLists hold subjects whose decisions bypass the policy. A principal on the deny list is denied
+// everything and one on the allow list (break-glass accounts) is allowed everything, deny list wins when a
+// principal is on both
+type principalLists struct {
+	mutex     sync.RWMutex
+	allowList map[string]bool
+	denyList  map[string]bool
+}
+
+// SetPrincipalAllowList replaces the principals allowed everything without policy entries
+func (e *EnforcerImpl) SetPrincipalAllowList(emails []string) {
+	e.principals.mutex.Lock()
+	previous := e.principals.allowList
+	e.principals.allowList = toPrincipalSet(emails)
+	e.principals.mutex.Unlock()
+	e.invalidatePrincipals(previous, emails)
+}
+
+// SetPrincipalDenyList replaces the principals denied everything regardless of policy entries
+func (e *EnforcerImpl) SetPrincipalDenyList(emails []string) {
+	e.principals.mutex.Lock()
+	previous := e.principals.denyList
+	e.principals.denyList = toPrincipalSet(emails)
+	e.principals.mutex.Unlock()
+	e.invalidatePrincipals(previous, emails)
+}
+
+// principalDecision returns the decision forced on subject by the principal lists, decided is false if the
+// subject is on neither list and the policy has to be evaluated
+func (e *EnforcerImpl) principalDecision(subject string) (allowed bool, decided bool) {
+	return e.normalizedPrincipalDecision(strings.ToLower(subject))
+}
+
+// normalizedPrincipalDecision is principalDecision for an already lower cased subject
+func (e *EnforcerImpl) normalizedPrincipalDecision(subject string) (allowed bool, decided bool) {
+	e.principals.mutex.RLock()
+	defer e.principals.mutex.RUnlock()
+	if e.principals.denyList[subject] {
+		return false, true
+	}
+	if e.principals.allowList[subject] {
+		return true, true
+	}
+	return false, false
+}
+
+// invalidatePrincipals drops cached decisions of principals added to or removed from a list
+func (e *EnforcerImpl) invalidatePrincipals(previous map[string]bool, emails []string) {
+	for emailId := range previous {
+		e.InvalidateCache(emailId)
+	}
+	for _, emailId := range emails {
+		e.InvalidateCache(strings.ToLower(emailId))
+	}
+}
+
+func toPrincipalSet(emails []string) map[string]bool {
+	principals := make(map[string]bool, len(emails))
+	for _, emailId := range emails {
+		principals[strings.ToLower(emailId)] = true
+	}
+	return principals
+}
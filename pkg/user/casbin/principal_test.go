@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestPrincipalLists(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	enforcer.SetPrincipalAllowList([]string{"Breakglass@example.com", "both@example.com"})
+	enforcer.SetPrincipalDenyList([]string{"both@example.com", "user@example.com"})
+	tests := []struct {
+		name    string
+		subject string
+		want    bool
+	}{
+		{name: "allow listed without policy", subject: "breakglass@example.com", want: true},
+		{name: "on both lists, deny wins", subject: "both@example.com", want: false},
+		{name: "deny listed with allowing policy", subject: "user@example.com", want: false},
+		{name: "on no list without policy", subject: "other@example.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := enforcer.EnforceByEmail(tt.subject, "applications", "get", "team1/app1"); got != tt.want {
+				t.Errorf("EnforceByEmail() = %v, want %v", got, tt.want)
+			}
+			token := newTestToken(t, jwt.MapClaims{"email": tt.subject})
+			if got := enforcer.Enforce(token, "applications", "get", "team1/app1"); got != tt.want {
+				t.Errorf("Enforce() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrincipalDenyListOfAutoGrantedAdmin(t *testing.T) {
+	t.Setenv("ENFORCER_ADMIN_AUTO_GRANT", "true")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	token := newTestToken(t, jwt.MapClaims{"sub": "admin"})
+	if !enforcer.Enforce(token, "applications", "delete", "team9/app1") {
+		t.Fatalf("Enforce() of auto granted admin = false, want true")
+	}
+	enforcer.SetPrincipalDenyList([]string{"Admin"})
+	if allowed, subject, err := enforcer.EnforceResolve(token, "applications", "delete", "team9/app1"); allowed || subject != "admin" || err != nil {
+		t.Errorf("EnforceResolve() of deny listed admin = %v, %q, %v, want denied", allowed, subject, err)
+	}
+}
+
+func TestPrincipalListInvalidatesCache(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	if result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1"}); !result["team1/app1"] {
+		t.Fatalf("EnforceByEmailInBatch() = false before deny listing, want true")
+	}
+	enforcer.SetPrincipalDenyList([]string{"user@example.com"})
+	if result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1"}); result["team1/app1"] {
+		t.Errorf("EnforceByEmailInBatch() = true after deny listing, want false")
+	}
+	enforcer.SetPrincipalDenyList(nil)
+	if result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1"}); !result["team1/app1"] {
+		t.Errorf("EnforceByEmailInBatch() = false after removal from deny list, want true")
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+// PermissionProfile is a snapshot of the decisions of a user, e.g. for exporting them
+type PermissionProfile struct {
+	EmailId string `json:"emailId"`
+	// Decisions is keyed by resource, then action, then object
+	Decisions map[string]map[string]map[string]bool `json:"decisions"`
+}
+
+// Allowed returns the decision of the profile for resource, action and object, false if it was not computed
+func (p PermissionProfile) Allowed(resource string, action string, object string) bool {
+	return p.Decisions[resource][action][object]
+}
+
+// ComputePermissionProfile evaluates the decisions of emailId for every action of resources over the resource's
+// objects as a single mixed batch, see EnforceByEmailMixedBatch, and returns them as a profile. Decisions are
+// cached like those of any other batch. A rate limited emailId gets an empty profile and ErrRateLimited
+func (e *EnforcerImpl) ComputePermissionProfile(emailId string, resources []string, actions []string, objects map[string][]string) (PermissionProfile, error) {
+	var checks []ResourceActionObject
+	for _, resource := range resources {
+		for _, action := range actions {
+			for _, object := range objects[resource] {
+				checks = append(checks, ResourceActionObject{Resource: resource, Action: action, Object: object})
+			}
+		}
+	}
+	profile := PermissionProfile{EmailId: emailId, Decisions: make(map[string]map[string]map[string]bool, len(resources))}
+	decisions, err := e.EnforceByEmailMixedBatch(emailId, checks)
+	if err != nil {
+		return profile, err
+	}
+	for _, check := range checks {
+		actionDecisions, found := profile.Decisions[check.Resource]
+		if !found {
+			actionDecisions = make(map[string]map[string]bool, len(actions))
+			profile.Decisions[check.Resource] = actionDecisions
+		}
+		objectDecisions, found := actionDecisions[check.Action]
+		if !found {
+			objectDecisions = make(map[string]bool, len(objects[check.Resource]))
+			actionDecisions[check.Action] = objectDecisions
+		}
+		objectDecisions[check.Object] = decisions[check]
+	}
+	return profile, nil
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestComputePermissionProfile(t *testing.T) {
+	resources := []string{"applications", "environment"}
+	actions := []string{"get", "delete"}
+	objects := map[string][]string{
+		"applications": {"team1/app1", "team2/app1", "team3/app1", "team4/app1"},
+		"environment":  {"env1/app1"},
+	}
+	profile, err := newTestEnforcer(t, false, testPolicies, testGroupings).ComputePermissionProfile("user@example.com", resources, actions, objects)
+	if err != nil {
+		t.Fatalf("ComputePermissionProfile() error = %v", err)
+	}
+	if profile.EmailId != "user@example.com" {
+		t.Errorf("EmailId = %q, want user@example.com", profile.EmailId)
+	}
+
+	individual := newTestEnforcer(t, false, testPolicies, testGroupings)
+	for _, resource := range resources {
+		for _, action := range actions {
+			for _, object := range objects[resource] {
+				decision, found := profile.Decisions[resource][action][object]
+				if !found {
+					t.Errorf("profile lacks %s %s %s", resource, action, object)
+				}
+				if want := individual.EnforceByEmail("user@example.com", resource, action, object); decision != want || profile.Allowed(resource, action, object) != want {
+					t.Errorf("profile decision of %s %s %s = %v, want %v", resource, action, object, decision, want)
+				}
+			}
+		}
+	}
+	if profile.Allowed("applications", "get", "team9/app1") {
+		t.Errorf("Allowed() of an object outside the profile = true")
+	}
+
+	encoded, err := json.Marshal(profile)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	var decoded PermissionProfile
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, profile) {
+		t.Errorf("decoded profile = %+v, want %+v", decoded, profile)
+	}
+}
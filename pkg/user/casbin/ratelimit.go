@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// subjectLimiterExpiration is how long the limiter of an idle subject is kept, a subject coming back after it
+// starts over with a full bucket
+const subjectLimiterExpiration = 10 * time.Minute
+
+// ErrRateLimited is returned by batch enforcements of a subject over ENFORCER_SUBJECT_RATE_LIMIT_PER_SEC, with no
+// results
+var ErrRateLimited = status.Error(codes.ResourceExhausted, "batch enforcement rate limit exceeded")
+
+// subjectLimiters holds a token bucket per subject, limiting its batch enforcements
+type subjectLimiters struct {
+	mutex    sync.Mutex
+	limiters *cache.Cache
+	limit    rate.Limit
+	burst    int
+}
+
+func newSubjectLimiters(config *EnforcerConfig) *subjectLimiters {
+	if config.SubjectRateLimitPerSec <= 0 {
+		return nil
+	}
+	burst := config.SubjectRateLimitBurst
+	if burst <= 0 {
+		burst = 1
+	}
+	return &subjectLimiters{
+		limiters: cache.New(subjectLimiterExpiration, subjectLimiterExpiration),
+		limit:    rate.Limit(config.SubjectRateLimitPerSec),
+		burst:    burst,
+	}
+}
+
+// allow takes a token from the bucket of subject, creating the bucket on first use
+func (l *subjectLimiters) allow(subject string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	limiter, ok := l.get(subject)
+	if !ok {
+		limiter = rate.NewLimiter(l.limit, l.burst)
+	}
+	// refreshing the expiration, the bucket of an active subject must not be dropped
+	l.limiters.Set(subject, limiter, cache.DefaultExpiration)
+	return limiter.Allow()
+}
+
+func (l *subjectLimiters) get(subject string) (*rate.Limiter, bool) {
+	cached, found := l.limiters.Get(subject)
+	if !found {
+		return nil, false
+	}
+	limiter, ok := cached.(*rate.Limiter)
+	return limiter, ok
+}
+
+// rateLimitTakenKey marks a context whose call already took its token, see takeSubjectRateLimit
+type rateLimitTakenKey struct{}
+
+// checkSubjectRateLimit returns ErrRateLimited when emailId exceeded ENFORCER_SUBJECT_RATE_LIMIT_PER_SEC, nil when
+// it didn't, rate limiting is disabled or ctx comes from takeSubjectRateLimit
+func (e *EnforcerImpl) checkSubjectRateLimit(ctx context.Context, emailId string) error {
+	if e.subjectLimiters == nil || ctx.Value(rateLimitTakenKey{}) != nil || e.subjectLimiters.allow(strings.ToLower(emailId)) {
+		return nil
+	}
+	return ErrRateLimited
+}
+
+// takeSubjectRateLimit takes a single token of emailId for a public call made of several batches, e.g.
+// EnforceByEmailMixedBatch, returning the context its batches are to run with so that they don't take one each
+func (e *EnforcerImpl) takeSubjectRateLimit(ctx context.Context, emailId string) (context.Context, error) {
+	if err := e.checkSubjectRateLimit(ctx, emailId); err != nil {
+		e.logger.Warnw("skipping enforcement over the subject's rate limit", "emailId", emailId)
+		return ctx, err
+	}
+	return context.WithValue(ctx, rateLimitTakenKey{}, true), nil
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSubjectRateLimit(t *testing.T) {
+	t.Setenv("ENFORCER_SUBJECT_RATE_LIMIT_PER_SEC", "0.01")
+	t.Setenv("ENFORCER_SUBJECT_RATE_LIMIT_BURST", "2")
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	enforce := func(emailId string) (map[string]bool, error) {
+		return enforcer.EnforceByEmailInBatchWithContext(context.Background(), emailId, "applications", "get", []string{"team1/app1"})
+	}
+	for i := 0; i < 2; i++ {
+		if result, err := enforce("user@example.com"); err != nil || !result["team1/app1"] {
+			t.Fatalf("batch %d within the limit = %v, %v, want allowed", i, result, err)
+		}
+	}
+	result, err := enforce("User@example.com")
+	if !errors.Is(err, ErrRateLimited) || status.Code(err) != codes.ResourceExhausted || len(result) != 0 {
+		t.Errorf("batch over the limit = %v, %v, want no results and a ResourceExhausted error", result, err)
+	}
+	if allAllowed, _ := enforcer.EnforceByEmailUntilDeny("user@example.com", "applications", "get", []string{"team1/app1"}); allAllowed {
+		t.Errorf("EnforceByEmailUntilDeny() over the limit allowed")
+	}
+	if _, err := enforce("other@example.com"); err != nil {
+		t.Errorf("batch of another subject error = %v, want its own limit", err)
+	}
+}
+
+func TestSubjectRateLimitOfCompositeCalls(t *testing.T) {
+	t.Setenv("ENFORCER_SUBJECT_RATE_LIMIT_PER_SEC", "0.01")
+	t.Setenv("ENFORCER_SUBJECT_RATE_LIMIT_BURST", "3")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	// each action is a batch of its own, the call must still take a single token
+	actions := []string{"get", "delete", "update", "create", "trigger"}
+	for i := 0; i < 2; i++ {
+		if allowed, err := enforcer.AllowedActions("user@example.com", "applications", "team1/app1", actions); err != nil || len(allowed) != 1 {
+			t.Fatalf("AllowedActions() %d within the limit = %v, %v, want get allowed", i, allowed, err)
+		}
+	}
+	vals := make([]string, bitsChunkSize+10)
+	for i := range vals {
+		vals[i] = fmt.Sprintf("team1/app%d", i)
+	}
+	if allowed, err := enforcer.EnforceByEmailBatchBits("user@example.com", "applications", "get", vals); err != nil || allowed.Count() != len(vals) {
+		t.Fatalf("EnforceByEmailBatchBits() over several chunks within the limit = %v, want all allowed", err)
+	}
+	if allowed, err := enforcer.AllowedActions("user@example.com", "applications", "team1/app1", actions); !errors.Is(err, ErrRateLimited) || len(allowed) != 0 {
+		t.Errorf("AllowedActions() over the limit = %v, %v, want ErrRateLimited", allowed, err)
+	}
+	if _, err := enforcer.EnforceByEmailBatchBits("user@example.com", "applications", "get", vals); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("EnforceByEmailBatchBits() over the limit error = %v, want ErrRateLimited", err)
+	}
+	if err := enforcer.WarmUser("user@example.com", []string{"applications"}, actions, map[string][]string{"applications": {"team2/app1"}}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("WarmUser() over the limit error = %v, want ErrRateLimited", err)
+	}
+	if enforcer.IsCached("user@example.com", "applications", "get", "team2/app1") {
+		t.Errorf("WarmUser() over the limit cached decisions")
+	}
+	if _, err := enforcer.ComputePermissionProfile("user@example.com", []string{"applications"}, actions, map[string][]string{"applications": {"team2/app1"}}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("ComputePermissionProfile() over the limit error = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestSubjectRateLimitDisabled(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	for i := 0; i < 50; i++ {
+		if _, err := enforcer.EnforceByEmailInBatchWithContext(context.Background(), "user@example.com", "applications", "get", []string{"team1/app1"}); err != nil {
+			t.Fatalf("batch %d without rate limit error = %v", i, err)
+		}
+	}
+}
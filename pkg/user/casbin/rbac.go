@@ -18,20 +18,28 @@
 package casbin
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/caarlos0/env"
 	"github.com/casbin/casbin"
-	"github.com/devtron-labs/authenticator/jwt"
 	"github.com/devtron-labs/authenticator/middleware"
 	"github.com/patrickmn/go-cache"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"math"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 type Enforcer interface {
@@ -39,21 +47,122 @@ type Enforcer interface {
 	EnforceErr(rvals ...interface{}) error
 	EnforceByEmail(rvals ...interface{}) bool
 	EnforceByEmailInBatch(emailId string, resource string, action string, vals []string) map[string]bool
+	EnforceByEmailE(rvals ...interface{}) (bool, error)
+	EnforceByEmailInBatchE(emailId string, resource string, action string, vals []string) (map[string]bool, error)
 	InvalidateCache(emailId string) bool
 	InvalidateCompleteCache()
+	CacheEnabled() bool
+	// GetAllSubjects and GetAllRoles are promoted from the embedded casbin enforcer
+	GetAllSubjects() []string
+	GetAllRoles() []string
 }
 
+// NewEnforcerImpl wraps enforcer, only the enforcer over the casbin enforcer built by Create is registered
+// through SetGlobalEnforcerImpl
 func NewEnforcerImpl(
 	enforcer *casbin.Enforcer,
 	sessionManager *middleware.SessionManager,
 	logger *zap.SugaredLogger) *EnforcerImpl {
-	lock := make(map[string]*sync.Mutex)
-	enf := &EnforcerImpl{lock: lock, Cache: checkCacheEnabled(logger), Enforcer: enforcer, logger: logger, SessionManager: sessionManager}
-	setEnforcerImpl(enf)
+	return NewEnforcerImplWithLogger(enforcer, sessionManager, logger)
+}
+
+// NewEnforcerImplWithLogger is NewEnforcerImpl logging to logger, e.g. a log/slog logger adapted by NewSlogLogger
+func NewEnforcerImplWithLogger(
+	enforcer *casbin.Enforcer,
+	sessionManager *middleware.SessionManager,
+	logger Logger) *EnforcerImpl {
+	config := &EnforcerConfig{}
+	err := env.Parse(config)
+	if err != nil {
+		logger.Errorw("error in parsing enforcer config, using defaults", "err", err)
+	}
+	enf := &EnforcerImpl{Cache: checkCacheEnabled(logger), Enforcer: enforcer, logger: logger, SessionManager: sessionManager,
+		config: config, tokenCache: newTokenCache(config), policyLoaded: make(chan struct{}),
+		subjectLimiters: newSubjectLimiters(config), batchSlots: newBatchSlots(config)}
+	enf.shards = newCacheShards(config.CacheShards, enf.Cache != nil)
+	wired := enforcer != nil && enforcer == e
+	if !config.WaitForPolicyLoad || wired {
+		enf.MarkPolicyLoaded()
+	}
+	enf.RegisterResources(defaultResources...)
+	if config.CacheDebugLogPath != "" {
+		enf.openCacheRecorder(config.CacheDebugLogPath)
+	}
+	if wired {
+		SetGlobalEnforcerImpl(enf)
+	}
 	return enf
 }
 
-func checkCacheEnabled(logger *zap.SugaredLogger) *cache.Cache {
+type EnforcerConfig struct {
+	// BatchTimeoutInMs bounds a complete batch enforcement, 0 means no limit
+	BatchTimeoutInMs int `env:"ENFORCER_BATCH_TIMEOUT_IN_MS" envDefault:"0"`
+	// TokenCacheExpirationInSec keeps verified token claims for repeated enforce calls, 0 disables the cache
+	TokenCacheExpirationInSec int `env:"ENFORCER_TOKEN_CACHE_EXPIRATION_IN_SEC" envDefault:"0"`
+	// CacheNamespace prefixes cache keys, needed when multiple enforcers share a backing cache
+	CacheNamespace string `env:"ENFORCER_CACHE_NAMESPACE" envDefault:""`
+	// DefaultRole is checked for every subject denied by its own policies, empty disables it
+	DefaultRole string `env:"ENFORCER_DEFAULT_ROLE" envDefault:""`
+	// BatchSyncThreshold is the input size up to which batches are evaluated on the calling goroutine
+	BatchSyncThreshold int `env:"ENFORCER_BATCH_SYNC_THRESHOLD" envDefault:"1"`
+	// BatchSingleFlight coalesces concurrent batch requests for the same email, resource, action and objects, and
+	// evaluates objects requested by overlapping concurrent batches once
+	BatchSingleFlight bool `env:"ENFORCER_BATCH_SINGLE_FLIGHT" envDefault:"false"`
+	// SlidingExpiration restarts the expiration of an email's cache entry on every read, turning it off bounds
+	// how long a cached decision can outlive a policy change to the cache expiration
+	SlidingExpiration bool `env:"ENFORCER_CACHE_SLIDING_EXPIRATION" envDefault:"true"`
+	// StrictResources fails enforcement of resources not registered through RegisterResources
+	StrictResources bool `env:"ENFORCER_STRICT_RESOURCES" envDefault:"false"`
+	// SlowEnforcementThresholdInMs logs enforcements taking longer at Warn and the rest at Debug, 0 keeps logging
+	// every batch at Info
+	SlowEnforcementThresholdInMs int `env:"ENFORCER_SLOW_ENFORCEMENT_THRESHOLD_IN_MS" envDefault:"0"`
+	// DefaultAction is enforced by batches requested with an empty action, results are cached under it as if it
+	// was requested. When empty, batches without an action are rejected
+	DefaultAction string `env:"ENFORCER_DEFAULT_ACTION" envDefault:""`
+	// BatchRetryCount is the number of times a batch object whose evaluation failed transiently, e.g. while the
+	// policies are reloaded, is evaluated again, 0 disables retries
+	BatchRetryCount int `env:"ENFORCER_BATCH_RETRY_COUNT" envDefault:"0"`
+	// BatchRetryBackoffInMs is the wait before the first retry, doubled for every further one
+	BatchRetryBackoffInMs int `env:"ENFORCER_BATCH_RETRY_BACKOFF_IN_MS" envDefault:"10"`
+	// WaitForPolicyLoad holds enforcements until MarkPolicyLoaded is called, for enforcers created before their
+	// initial policy load completes, for up to PolicyLoadTimeoutInMs. The enforcer over the casbin enforcer built
+	// by Create is not held, Create loads its policies before returning
+	WaitForPolicyLoad     bool `env:"ENFORCER_WAIT_FOR_POLICY_LOAD" envDefault:"false"`
+	PolicyLoadTimeoutInMs int  `env:"ENFORCER_POLICY_LOAD_TIMEOUT_IN_MS" envDefault:"5000"`
+	// SubjectRateLimitPerSec limits the batch enforcements of every subject to a token bucket refilled at this rate
+	// holding up to SubjectRateLimitBurst, batches beyond it fail with codes.ResourceExhausted. 0 disables it
+	SubjectRateLimitPerSec float64 `env:"ENFORCER_SUBJECT_RATE_LIMIT_PER_SEC" envDefault:"0"`
+	SubjectRateLimitBurst  int     `env:"ENFORCER_SUBJECT_RATE_LIMIT_BURST" envDefault:"10"`
+	// AdminAutoGrant allows locally issued admin tokens everything without an admin policy, when off such tokens
+	// are enforced against the policies of the admin subject and a warning is logged if there are none
+	AdminAutoGrant bool `env:"ENFORCER_ADMIN_AUTO_GRANT" envDefault:"false"`
+	// CacheShards splits the cache and its per email locks into shards by a hash of the email, so that distinct
+	// emails don't contend on the same structures
+	CacheShards int `env:"ENFORCER_CACHE_SHARDS" envDefault:"1"`
+	// MaxBatchGoroutines bounds the goroutines evaluating objects across all concurrent batches, further parts of
+	// batches wait for one of them to finish. 0 means no bound
+	MaxBatchGoroutines int `env:"ENFORCER_MAX_BATCH_GOROUTINES" envDefault:"0"`
+	// CacheDebugLogPath is a file every cache store and invalidation is appended to, for debugging intermittent
+	// decisions, see SetCacheRecorder. Empty disables the recording
+	CacheDebugLogPath string `env:"ENFORCER_CACHE_DEBUG_LOG_PATH" envDefault:""`
+	// AllowAnonymous enforces requests without a token as AnonymousSubject instead of failing their verification,
+	// for endpoints whose read access is granted through policies of that subject. Policies of the "*" subject
+	// apply to it as well
+	AllowAnonymous   bool   `env:"ENFORCER_ALLOW_ANONYMOUS" envDefault:"false"`
+	AnonymousSubject string `env:"ENFORCER_ANONYMOUS_SUBJECT" envDefault:"anonymous"`
+	// TokenAudience and TokenIssuer are the aud and iss claims verified tokens must carry before being enforced,
+	// empty values are not checked
+	TokenAudience string `env:"ENFORCER_TOKEN_AUDIENCE" envDefault:""`
+	TokenIssuer   string `env:"ENFORCER_TOKEN_ISSUER" envDefault:""`
+	// CacheTimeoutInMs bounds the wait of cache reads and stores for other operations on the same email's entry,
+	// reads timing out are evaluated without the cache and stores are dropped. 0 waits indefinitely
+	CacheTimeoutInMs int `env:"ENFORCER_CACHE_TIMEOUT_IN_MS" envDefault:"1000"`
+	// CaseInsensitiveKeys lower cases the resource and action of by email enforcements before they are evaluated
+	// and cached, so that App and app share a cache entry. Policies must then be written in lower case
+	CaseInsensitiveKeys bool `env:"ENFORCER_CASE_INSENSITIVE_KEYS" envDefault:"false"`
+}
+
+func checkCacheEnabled(logger Logger) *cache.Cache {
 	enableEnforcerCache := os.Getenv("ENFORCER_CACHE")
 	enableEnforcerCacheVal, err := strconv.ParseBool(enableEnforcerCache)
 	if err != nil {
@@ -61,18 +170,27 @@ func checkCacheEnabled(logger *zap.SugaredLogger) *cache.Cache {
 		enableEnforcerCacheVal = false
 	}
 	if enableEnforcerCacheVal {
-		enforcerCacheExpirationInSec := os.Getenv("ENFORCER_CACHE_EXPIRATION_IN_SEC")
-		enforcerCacheExpirationDuration := EnforcerCacheDefaultExpiration
-		enforcerCacheExpirationValue, err := strconv.Atoi(enforcerCacheExpirationInSec)
-		if err == nil {
-			enforcerCacheExpirationDuration = time.Second * time.Duration(enforcerCacheExpirationValue)
-		}
+		enforcerCacheExpirationDuration := getCacheExpiration()
 		logger.Infow("enforce cache enabled", "expiry", enforcerCacheExpirationDuration)
-		return cache.New(enforcerCacheExpirationDuration, 5*time.Minute)
+		return newEnforcerCache()
 	}
 	return nil
 }
 
+func getCacheExpiration() time.Duration {
+	enforcerCacheExpirationInSec := os.Getenv("ENFORCER_CACHE_EXPIRATION_IN_SEC")
+	enforcerCacheExpirationDuration := EnforcerCacheDefaultExpiration
+	enforcerCacheExpirationValue, err := strconv.Atoi(enforcerCacheExpirationInSec)
+	if err == nil {
+		enforcerCacheExpirationDuration = time.Second * time.Duration(enforcerCacheExpirationValue)
+	}
+	return enforcerCacheExpirationDuration
+}
+
+func newEnforcerCache() *cache.Cache {
+	return cache.New(getCacheExpiration(), 5*time.Minute)
+}
+
 // Enforcer is a wrapper around an Casbin enforcer that:
 // * is backed by a kubernetes config map
 // * has a predefined RBAC model
@@ -80,11 +198,38 @@ func checkCacheEnabled(logger *zap.SugaredLogger) *cache.Cache {
 // * supports a user-defined bolicy
 // * supports a custom JWT claims enforce function
 type EnforcerImpl struct {
-	lock map[string]*sync.Mutex
+	// shards split the per email locks and cache entries, the first shard's entries are held by Cache
+	shards []*cacheShard
 	*cache.Cache
 	*casbin.Enforcer
 	*middleware.SessionManager
-	logger *zap.SugaredLogger
+	logger          Logger
+	config          *EnforcerConfig
+	tokenCache      *cache.Cache
+	subjectLimiters *subjectLimiters
+	// batchSlots bounds the goroutines of concurrent batches, see EnforcerConfig.MaxBatchGoroutines
+	batchSlots      chan struct{}
+	principals      principalLists
+	actions         actionInheritance
+	resources       knownResources
+	subjectResolver subjectResolver
+	audit           auditSink
+	cacheRecorder   cacheRecorder
+	invalidation    invalidationHook
+	// policyLoaded is closed by MarkPolicyLoaded
+	policyLoaded     chan struct{}
+	policyLoadedOnce sync.Once
+	// policyGeneration counts the policy reloads, cache entries of an older generation are misses
+	policyGeneration uint64
+	// invalidations counts local cache invalidations, a PermissionSet built before one is stale
+	invalidations uint64
+	stats         atomic.Value
+	// emptyPolicyWarned is set once the warning about an enforcer without policies is logged
+	emptyPolicyWarned int32
+	// adminUngrantedWarned is set once the warning about an admin subject without policies is logged
+	adminUngrantedWarned int32
+	batchGroup           singleflight.Group
+	objectFlights        objectFlights
 }
 
 // Enforce is a wrapper around casbin.Enforce to additionally enforce a default role and a custom
@@ -97,58 +242,943 @@ func (e *EnforcerImpl) EnforceByEmail(rvals ...interface{}) bool {
 	return e.enforceByEmail(e.Enforcer, rvals...)
 }
 
+// EnforceAgainst is Enforce evaluated against enf instead of the live enforcer, e.g. to preview a proposed policy
+// change. Decisions against another enforcer are never cached nor audited
+func (e *EnforcerImpl) EnforceAgainst(enf *casbin.Enforcer, rvals ...interface{}) bool {
+	return e.enforce(enf, rvals...)
+}
+
+// EnforceSubject is EnforceByEmail for hot paths already holding a normalized, i.e. lower cased, subject. It skips
+// normalization and the result cache, only the principal lists and the policy are evaluated
+func (e *EnforcerImpl) EnforceSubject(subject string, resource string, action string, object string) bool {
+	if allowed, decided := e.normalizedPrincipalDecision(subject); decided {
+		return allowed
+	}
+	allowed, err := e.enforcePolicy(e.Enforcer, subject, resource, action, object)
+	if err != nil {
+		e.logger.Errorw("panic occurred", "err", err)
+	}
+	return allowed
+}
+
+// EnforceAsRoles previews a decision for a subject holding exactly roles, e.g. to check what granting a role would
+// change before persisting it. Like for a subject holding them, the request is allowed when some role allows it and
+// no role denies it. Resource and action are normalized as by EnforceByEmail. Previews are never cached
+func (e *EnforcerImpl) EnforceAsRoles(resource string, action string, object string, roles []string) bool {
+	resource, action = e.normalizeKeys(resource, action)
+	allowed := false
+	for _, role := range roles {
+		role = strings.ToLower(role)
+		if e.roleDenies(role, resource, action, object) {
+			return false
+		}
+		if !allowed {
+			roleAllowed, err := e.enforcePolicy(e.Enforcer, role, resource, action, object)
+			if err != nil {
+				e.logger.Errorw("panic occurred", "err", err)
+			}
+			allowed = roleAllowed && err == nil
+		}
+	}
+	return allowed
+}
+
+// roleDenies tells whether a deny policy of role, or of a role it inherits, matches the request. Deny policies of
+// one role only show up in the decisions of another when both are evaluated as a single subject, which
+// EnforceAsRoles can't do without persisting the roles, so they are matched here the way auth_model.conf does
+func (e *EnforcerImpl) roleDenies(role string, resource string, action string, object string) bool {
+	for _, policy := range e.Enforcer.GetFilteredPolicy(4, "deny") {
+		if e.policyAppliesTo(role, policy[0]) && matchesPolicy(policy, resource, []string{action}, object) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDenyPolicyOn tells whether any deny policy applying to subject is written for resource
+func (e *EnforcerImpl) hasDenyPolicyOn(subject string, resource string) bool {
+	for _, policy := range e.Enforcer.GetFilteredPolicy(4, "deny") {
+		if e.policyAppliesTo(subject, policy[0]) && MatchKeyByPart(resource, policy[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// getUsersForRole returns the direct users of role, false when the enforcer has no role links built to resolve
+// them from, the RM casbin's GetUsersForRole dereferences is nil until groupings are loaded
+func (e *EnforcerImpl) getUsersForRole(role string) ([]string, bool) {
+	assertion, found := e.Enforcer.GetModel()["g"]["g"]
+	if !found || assertion.RM == nil {
+		return nil, false
+	}
+	users, err := e.Enforcer.GetUsersForRole(role)
+	return users, err == nil
+}
+
+// deniedByPolicy tells whether a deny policy of enf matches rvals, the subject, resource, action and object of a
+// request, as per MatchKeyByPart
+func deniedByPolicy(enf *casbin.Enforcer, rvals ...interface{}) bool {
+	if len(rvals) < 4 {
+		return false
+	}
+	subject, ok1 := rvals[0].(string)
+	resource, ok2 := rvals[1].(string)
+	action, ok3 := rvals[2].(string)
+	object, ok4 := rvals[3].(string)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return false
+	}
+	for _, policy := range enf.GetFilteredPolicy(4, "deny") {
+		if MatchKeyByPart(resource, policy[1]) && MatchKeyByPart(action, policy[2]) && MatchKeyByPart(object, policy[3]) &&
+			policyAppliesToIn(enf, subject, policy[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyAppliesTo tells whether policies of policySubject apply to subject, i.e. it is the subject itself, a role
+// it inherits or "*"
+func (e *EnforcerImpl) policyAppliesTo(subject string, policySubject string) bool {
+	return policyAppliesToIn(e.Enforcer, subject, policySubject)
+}
+
+// policyAppliesToIn is policyAppliesTo for the policies and role links of enf
+func policyAppliesToIn(enf *casbin.Enforcer, subject string, policySubject string) bool {
+	if policySubject == subject || MatchSubject(subject, policySubject) {
+		return true
+	}
+	assertion, found := enf.GetModel()["g"]["g"]
+	if !found || assertion.RM == nil {
+		return false
+	}
+	inherited, err := assertion.RM.HasLink(subject, policySubject)
+	return err == nil && inherited
+}
+
+// allowsEveryObject tells whether subject holds a grant of every action on every object of resource, which no deny
+// policy of resource can narrow, so that a batch needs no per-object evaluation. The grant is a policy applying to
+// subject whose action and object are the unescaped "*" pattern, enforcing a "*" request instead would also be
+// allowed by policies of the literal `\*` object. Only DefaultModel is known to have no other condition than deny
+// policies, a custom model is always evaluated per object
+func (e *EnforcerImpl) allowsEveryObject(subject string, resource string) bool {
+	if !runsDefaultModel(e.Enforcer) {
+		return false
+	}
+	if _, decided := e.principalDecision(subject); decided || e.hasDenyPolicyOn(subject, resource) {
+		return false
+	}
+	for _, policy := range e.Enforcer.GetModel()["p"]["p"].Policy {
+		if len(policy) > 4 && policy[4] == "allow" && policy[2] == "*" && policy[3] == "*" &&
+			MatchKeyByPart(resource, policy[1]) && e.policyAppliesTo(subject, policy[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPoliciesForObject lists the loaded policies, allow and deny alike, whose object pattern matches object as per
+// MatchKeyByPart, e.g. for admin views explaining who can access an object. Subjects and roles are not expanded
+func (e *EnforcerImpl) GetPoliciesForObject(object string) [][]string {
+	object = strings.ToLower(object)
+	var policies [][]string
+	for _, policy := range e.Enforcer.GetPolicy() {
+		if len(policy) > 3 && MatchKeyByPart(object, policy[3]) {
+			policies = append(policies, append([]string{}, policy...))
+		}
+	}
+	return policies
+}
+
+// EnforceAnySubject tells whether any of the subjects, e.g. the identities composing a service account, is allowed.
+// Subjects are evaluated in order and evaluation stops at the first allow
+func (e *EnforcerImpl) EnforceAnySubject(subjects []string, resource string, action string, object string) bool {
+	for _, subject := range subjects {
+		if e.EnforceByEmail(strings.ToLower(subject), resource, action, object) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnforceSubjectsForObject is the counterpart of EnforceByEmailInBatch for a single object, it returns the decision
+// of each of subjects, e.g. to tell who can see the object. Subjects are split across up to ENFORCER_MAX_BATCH_SIZE
+// goroutines like batch objects, decisions are looked up in and stored to the cache of each subject. Subjects whose
+// evaluation fails are denied, as are those left unevaluated when no goroutine slot frees up within
+// ENFORCER_BATCH_TIMEOUT_IN_MS. An empty action is ENFORCER_DEFAULT_ACTION like for batches
+func (e *EnforcerImpl) EnforceSubjectsForObject(subjects []string, resource string, action string, object string) map[string]bool {
+	result := make(map[string]bool, len(subjects))
+	if action == "" {
+		action = e.config.DefaultAction
+	}
+	resource, action = e.normalizeKeys(resource, action)
+	if len(subjects) == 0 || resource == "" || action == "" {
+		return result
+	}
+	if err := e.checkResource(resource); err != nil {
+		e.logger.Errorw("skipping subjects enforcement of unknown resource", "resource", resource, "action", action,
+			"size", len(subjects))
+		return result
+	}
+	enforceSubjects := func(subjects []string) map[string]bool {
+		decisions := make(map[string]bool, len(subjects))
+		for _, subject := range subjects {
+			allowed, err := e.enforceByEmailCached(e.Enforcer, strings.ToLower(subject), resource, action, object)
+			if err != nil {
+				e.logger.Errorw("error in enforcing subject", "subject", subject, "resource", resource, "action", action,
+					"object", object, "err", err)
+			}
+			decisions[subject] = allowed && err == nil
+		}
+		return decisions
+	}
+	totalSize := len(subjects)
+	batchSize := getBatchSize()
+	if batchSize > totalSize {
+		batchSize = totalSize
+	}
+	if totalSize <= e.config.BatchSyncThreshold {
+		return enforceSubjects(subjects)
+	}
+	ctx := context.Background()
+	if e.config.BatchTimeoutInMs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(e.config.BatchTimeoutInMs)*time.Millisecond)
+		defer cancel()
+	}
+	wg := sync.WaitGroup{}
+	mutex := sync.Mutex{}
+	started := batchSize
+	for i := 0; i < batchSize; i++ {
+		if !e.acquireBatchSlot(ctx) {
+			e.logger.Errorw("denying subjects left without a batch slot", "resource", resource, "action", action,
+				"object", object, "size", totalSize-i*totalSize/batchSize)
+			started = i
+			break
+		}
+		wg.Add(1)
+		go func(part []string) {
+			defer wg.Done()
+			defer e.releaseBatchSlot()
+			decisions := enforceSubjects(part)
+			mutex.Lock()
+			defer mutex.Unlock()
+			for subject, allowed := range decisions {
+				result[subject] = allowed
+			}
+		}(subjects[i*totalSize/batchSize : (i+1)*totalSize/batchSize])
+	}
+	wg.Wait()
+	for _, subject := range subjects[started*totalSize/batchSize:] {
+		result[subject] = false
+	}
+	return result
+}
+
 // EnforceErr is a convenience helper to wrap a failed enforcement with a detailed error about the request
 func (e *EnforcerImpl) EnforceErr(rvals ...interface{}) error {
 	if !e.Enforce(rvals...) {
-		errMsg := "permission denied"
-		if len(rvals) > 0 {
-			rvalsStrs := make([]string, len(rvals)-1)
-			for i, rval := range rvals[1:] {
-				rvalsStrs[i] = fmt.Sprintf("%s", rval)
-			}
-			errMsg = fmt.Sprintf("%s: %s", errMsg, strings.Join(rvalsStrs, ", "))
-		}
-		return status.Error(codes.PermissionDenied, errMsg)
+		return permissionDeniedErr(rvals...)
+	}
+	return nil
+}
+
+// EnforceAuthErr is same as EnforceErr but reports a token which fails verification as codes.Unauthenticated,
+// leaving codes.PermissionDenied for requests denied by the policy
+func (e *EnforcerImpl) EnforceAuthErr(rvals ...interface{}) error {
+	allowed, err := e.enforceE(e.Enforcer, rvals...)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return permissionDeniedErr(rvals...)
 	}
 	return nil
 }
 
+// EnforceResolve is same as EnforceAuthErr but returns the decision along with the subject the token was resolved
+// to, i.e. its lower cased email or admin for locally issued admin tokens as mapped by SetSubjectResolver, for
+// audit logging by callers
+func (e *EnforcerImpl) EnforceResolve(rvals ...interface{}) (allowed bool, subject string, err error) {
+	return e.enforceResolve(e.Enforcer, rvals...)
+}
+
+func permissionDeniedErr(rvals ...interface{}) error {
+	errMsg := "permission denied"
+	if len(rvals) > 0 {
+		rvalsStrs := make([]string, len(rvals)-1)
+		for i, rval := range rvals[1:] {
+			rvalsStrs[i] = fmt.Sprintf("%s", rval)
+		}
+		errMsg = fmt.Sprintf("%s: %s", errMsg, strings.Join(rvalsStrs, ", "))
+	}
+	return &permissionDeniedError{status: status.New(codes.PermissionDenied, errMsg)}
+}
+
+// ErrPermissionDenied matches, through errors.Is, the errors EnforceErr and EnforceAuthErr return for denied
+// requests, letting callers outside gRPC branch on a denial without inspecting the status code
+var ErrPermissionDenied = errors.New("permission denied")
+
+// permissionDeniedError is a codes.PermissionDenied status error wrapping ErrPermissionDenied
+type permissionDeniedError struct {
+	status *status.Status
+}
+
+func (e *permissionDeniedError) Error() string {
+	return e.status.Err().Error()
+}
+
+// GRPCStatus lets status.FromError and status.Code see the error as its gRPC status
+func (e *permissionDeniedError) GRPCStatus() *status.Status {
+	return e.status
+}
+
+func (e *permissionDeniedError) Unwrap() error {
+	return ErrPermissionDenied
+}
+
 func EnforceByEmailInBatchSync(e *EnforcerImpl, wg *sync.WaitGroup, mutex *sync.RWMutex, result map[string]bool, metrics map[int]int64, index int, emailId string, resource string, action string, vals []string) {
+	e.enforceByEmailInBatchSync(context.Background(), wg, mutex, result, make(map[string]error), metrics, nil, index, emailId, resource, action, vals)
+}
+
+// enforceByEmailInBatchSync is EnforceByEmailInBatchSync until ctx is done, collecting the errors of objects whose
+// evaluation failed into objectErrs and reporting the objects done to progress
+func (e *EnforcerImpl) enforceByEmailInBatchSync(ctx context.Context, wg *sync.WaitGroup, mutex *sync.RWMutex, result map[string]bool, objectErrs map[string]error, metrics map[int]int64, progress *batchProgress, index int, emailId string, resource string, action string, vals []string) {
 	defer wg.Done()
 	start := time.Now()
-	batchResult := make(map[string]bool)
-	for _, item := range vals {
-		batchResult[item] = e.EnforceByEmail(strings.ToLower(emailId), resource, action, item)
-	}
+	batchResult, batchErrs := e.enforceObjects(ctx, emailId, resource, action, vals)
 	duration := time.Since(start)
 	mutex.Lock()
 	defer mutex.Unlock()
 	for k, v := range batchResult {
 		result[k] = v
 	}
+	for k, v := range batchErrs {
+		objectErrs[k] = v
+	}
 	metrics[index] = duration.Milliseconds()
+	progress.advance(len(vals))
+}
+
+// batchProgress reports the objects done out of a batch's total to a caller's callback, advance is called with
+// the batch mutex held so reports are serialized and done never decreases
+type batchProgress struct {
+	callback func(done, total int)
+	done     int
+	total    int
+}
+
+func newBatchProgress(callback func(done, total int), total int) *batchProgress {
+	if callback == nil {
+		return nil
+	}
+	return &batchProgress{callback: callback, total: total}
+}
+
+func (p *batchProgress) advance(count int) {
+	if p == nil {
+		return
+	}
+	p.done += count
+	p.callback(p.done, p.total)
+}
+
+// enforceObjects evaluates vals serially on the calling goroutine until ctx is done. With ENFORCER_BATCH_SINGLE_FLIGHT,
+// objects concurrently evaluated by overlapping batches are evaluated once, see enforceObjectShared
+func (e *EnforcerImpl) enforceObjects(ctx context.Context, emailId string, resource string, action string, vals []string) (map[string]bool, map[string]error) {
+	result := make(map[string]bool, len(vals))
+	objectErrs := make(map[string]error)
+	for _, item := range vals {
+		if ctx.Err() != nil {
+			break
+		}
+		var allowed bool
+		var err error
+		if e.config.BatchSingleFlight {
+			var done bool
+			if allowed, done, err = e.enforceObjectShared(ctx, strings.ToLower(emailId), resource, action, item); !done {
+				break
+			}
+		} else {
+			allowed, err = e.enforceObjectWithRetry(ctx, strings.ToLower(emailId), resource, action, item)
+		}
+		result[item] = allowed
+		if err != nil {
+			objectErrs[item] = err
+		}
+	}
+	return result, objectErrs
+}
+
+// enforceObjectWithRetry evaluates a single batch object, retrying retryable failures up to
+// EnforcerConfig.BatchRetryCount times with an exponential backoff. The last error is returned once retries are
+// exhausted or ctx is done
+func (e *EnforcerImpl) enforceObjectWithRetry(ctx context.Context, emailId string, resource string, action string, object string) (bool, error) {
+	backoff := time.Duration(e.config.BatchRetryBackoffInMs) * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		allowed, err := e.enforceByEmailE(e.Enforcer, emailId, resource, action, object)
+		if err == nil || attempt >= e.config.BatchRetryCount || !isRetryableEnforceErr(err) {
+			return allowed, err
+		}
+		e.logger.Debugw("retrying enforce of batch object", "email", emailId, "resource", resource, "action", action, "object", object, "attempt", attempt+1, "err", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return allowed, err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryableEnforceErr reports whether err may go away on its own. Errors carrying a gRPC status are raised by the
+// enforcer itself for invalid requests and won't, failures of the underlying casbin evaluation might
+func isRetryableEnforceErr(err error) bool {
+	_, isStatus := status.FromError(err)
+	return !isStatus
+}
+
+func (e *EnforcerImpl) EnforceByEmailInBatch(emailId string, resource string, action string, vals []string) map[string]bool {
+	result, _, _ := e.enforceByEmailInBatch(context.Background(), emailId, resource, action, vals, getBatchSize(), nil)
+	return result
+}
+
+// errNoSubject is returned by the error returning enforce variants for requests without a subject
+var errNoSubject = status.Error(codes.Unauthenticated, "no subject to enforce")
+
+// EnforceByEmailE is same as EnforceByEmail but returns why a request could not be decided, a denial is false
+// with a nil error. Requests without an email fail with codes.Unauthenticated, other failures, e.g. an unknown
+// resource or a matcher error, with the evaluation's error
+func (e *EnforcerImpl) EnforceByEmailE(rvals ...interface{}) (bool, error) {
+	if len(rvals) == 0 {
+		return false, errNoSubject
+	}
+	if emailId, ok := rvals[0].(string); !ok || emailId == "" {
+		return false, errNoSubject
+	}
+	if e.config.SlowEnforcementThresholdInMs > 0 {
+		defer e.logSlowEnforcement(time.Now(), rvals)
+	}
+	allowed, err := e.enforceByEmailCached(e.Enforcer, rvals...)
+	if err != nil {
+		return false, err
+	}
+	e.auditDecision(e.Enforcer, allowed, rvals...)
+	return allowed, nil
+}
+
+// EnforceByEmailInBatchE is same as EnforceByEmailInBatch but returns why a batch, or some of its objects, could
+// not be decided, denied objects are false with a nil error. A batch without an email fails with
+// codes.Unauthenticated, invalid or rate limited batches with their error and no results. When objects fail to
+// evaluate, the error of the first of them in vals is returned along with the others' results
+func (e *EnforcerImpl) EnforceByEmailInBatchE(emailId string, resource string, action string, vals []string) (map[string]bool, error) {
+	if emailId == "" {
+		return map[string]bool{}, errNoSubject
+	}
+	result, objectErrs, err := e.enforceByEmailInBatch(context.Background(), emailId, resource, action, vals, getBatchSize(), nil)
+	if err != nil {
+		return result, err
+	}
+	var firstErr error
+	for _, object := range vals {
+		if objectErr, failed := objectErrs[object]; failed && firstErr == nil {
+			firstErr = objectErr
+		}
+	}
+	for object := range objectErrs {
+		delete(result, object)
+	}
+	return result, firstErr
+}
+
+// EnforceByEmailInBatchInto is EnforceByEmailInBatch filling dst, e.g. a map reused across calls of a hot loop.
+// dst is cleared first, it then holds the decisions of vals only and not the other cached objects of resource and
+// action. Requests filling a map are never coalesced by ENFORCER_BATCH_SINGLE_FLIGHT
+func (e *EnforcerImpl) EnforceByEmailInBatchInto(dst map[string]bool, emailId string, resource string, action string, vals []string) {
+	if dst == nil {
+		return
+	}
+	for object := range dst {
+		delete(dst, object)
+	}
+	_, _, _ = e.enforceByEmailInBatchInto(context.Background(), dst, emailId, resource, action, vals, getBatchSize(), nil)
+}
+
+// ObjectDecision is the outcome of enforcing a single object, Allowed is false whenever Err is set. Duration is
+// only recorded by EnforceByEmailInBatchProfiled
+type ObjectDecision struct {
+	Allowed  bool
+	Err      error
+	Duration time.Duration
+}
+
+// EnforceByEmailInBatchDetailed is same as EnforceByEmailInBatch but reports objects whose evaluation failed,
+// e.g. due to a matcher error, separately from denied ones. Failed objects are not cached. Empty objects, which
+// EnforceByEmailInBatch leaves out of its results, are reported with a codes.InvalidArgument error
+func (e *EnforcerImpl) EnforceByEmailInBatchDetailed(emailId string, resource string, action string, vals []string) map[string]ObjectDecision {
+	result, objectErrs, _ := e.enforceByEmailInBatch(context.Background(), emailId, resource, action, vals, getBatchSize(), nil)
+	decisions := make(map[string]ObjectDecision, len(result))
+	for object, allowed := range result {
+		decisions[object] = ObjectDecision{Allowed: allowed && objectErrs[object] == nil, Err: objectErrs[object]}
+	}
+	for object, err := range objectErrs {
+		if _, found := decisions[object]; !found {
+			decisions[object] = ObjectDecision{Err: err}
+		}
+	}
+	return decisions
+}
+
+// EnforceByEmailInBatchProfiled is a diagnostic EnforceByEmailInBatchDetailed recording the evaluation duration
+// of each object, e.g. to find patterns slow to match. Objects are evaluated one after another on the calling
+// goroutine and bypass the cache, so durations are those of the evaluation alone
+func (e *EnforcerImpl) EnforceByEmailInBatchProfiled(emailId string, resource string, action string, vals []string) map[string]ObjectDecision {
+	decisions := make(map[string]ObjectDecision, len(vals))
+	for _, object := range vals {
+		if _, found := decisions[object]; found {
+			continue
+		}
+		start := time.Now()
+		allowed, err := e.enforceByEmailE(e.Enforcer, strings.ToLower(emailId), resource, action, object)
+		decisions[object] = ObjectDecision{Allowed: allowed && err == nil, Err: err, Duration: time.Since(start)}
+	}
+	return decisions
+}
+
+// EnforceByEmailInBatchWithContext stops dispatching further enforcements once ctx is done, returning the
+// results computed so far along with ctx's error. ENFORCER_BATCH_TIMEOUT_IN_MS is applied over ctx if set.
+// vals are validated against the resource's object segment count, see ValidateObjectSegments
+func (e *EnforcerImpl) EnforceByEmailInBatchWithContext(ctx context.Context, emailId string, resource string, action string, vals []string) (map[string]bool, error) {
+	if err := ValidateObjectSegments(resource, vals); err != nil {
+		return nil, err
+	}
+	result, _, err := e.enforceByEmailInBatch(ctx, emailId, resource, action, vals, getBatchSize(), nil)
+	return result, err
+}
+
+// ResourceActionObject is a single check of EnforceByEmailMixedBatch
+type ResourceActionObject struct {
+	Resource string
+	Action   string
+	Object   string
+}
+
+// EnforceByEmailMixedBatch is EnforceByEmailInBatch for checks spanning several resources and actions. Checks are
+// grouped by resource and action, each group is a batch of its own evaluated concurrently with the others, by at
+// most ENFORCER_MAX_BATCH_GOROUTINES or else ENFORCER_MAX_BATCH_SIZE goroutines, and cached the same way. The call
+// takes a single rate limit token of emailId, failing with ErrRateLimited and no results when over the limit.
+// Checks a group failed to evaluate are denied, the error of the first of them in checks is returned along with
+// the results
+func (e *EnforcerImpl) EnforceByEmailMixedBatch(emailId string, checks []ResourceActionObject) (map[ResourceActionObject]bool, error) {
+	ctx, err := e.takeSubjectRateLimit(context.Background(), emailId)
+	if err != nil {
+		return map[ResourceActionObject]bool{}, err
+	}
+	groups := make(map[ResourceActionObject][]string)
+	var keys []ResourceActionObject
+	for _, check := range checks {
+		key := ResourceActionObject{Resource: check.Resource, Action: check.Action}
+		if _, found := groups[key]; !found {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], check.Object)
+	}
+	type groupOutcome struct {
+		result     map[string]bool
+		objectErrs map[string]error
+		err        error
+	}
+	outcomes := make([]groupOutcome, len(keys))
+	// a pool of its own rather than batchSlots, a group holding a slot while its batch waits for more of them
+	// would deadlock once all slots are held by groups
+	workers := e.config.MaxBatchGoroutines
+	if workers <= 0 {
+		workers = getBatchSize()
+	}
+	if workers > len(keys) {
+		workers = len(keys)
+	}
+	next := make(chan int, len(keys))
+	for i := range keys {
+		next <- i
+	}
+	close(next)
+	wg := new(sync.WaitGroup)
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				key := keys[i]
+				result, objectErrs, err := e.enforceByEmailInBatch(ctx, emailId, key.Resource, key.Action, groups[key], getBatchSize(), nil)
+				outcomes[i] = groupOutcome{result: result, objectErrs: objectErrs, err: err}
+			}
+		}()
+	}
+	wg.Wait()
+
+	index := make(map[ResourceActionObject]int, len(keys))
+	for i, key := range keys {
+		index[key] = i
+	}
+	result := make(map[ResourceActionObject]bool, len(checks))
+	var firstErr error
+	for _, check := range checks {
+		outcome := outcomes[index[ResourceActionObject{Resource: check.Resource, Action: check.Action}]]
+		checkErr := outcome.err
+		if checkErr == nil {
+			checkErr = outcome.objectErrs[check.Object]
+		}
+		if checkErr != nil && firstErr == nil {
+			firstErr = checkErr
+		}
+		result[check] = checkErr == nil && outcome.result[check.Object]
+	}
+	return result, firstErr
+}
+
+// EnforceByEmailUntilDeny tells whether all vals are allowed, stopping evaluation of the remaining objects as soon as
+// one is denied, which it returns. An object whose evaluation fails, and an empty object, counts as denied. With
+// batches evaluated concurrently, firstDenied is the first denial found and not necessarily the first denied object
+// of vals. Batches failing the checks of every other batch, e.g. of an unknown resource or over the rate limit of
+// emailId, are denied with an empty firstDenied
+func (e *EnforcerImpl) EnforceByEmailUntilDeny(emailId string, resource string, action string, vals []string) (allAllowed bool, firstDenied string) {
+	emailId = strings.ToLower(emailId)
+	if action == "" {
+		action = e.config.DefaultAction
+	}
+	resource, action = e.normalizeKeys(resource, action)
+	e.recordBatchSize(len(vals))
+	if err := e.checkBatch(context.Background(), emailId, resource, action, len(vals)); err != nil {
+		return false, ""
+	}
+	// captured before any evaluation, results of a policy reloaded meanwhile must not be cached
+	generation := e.PolicyGeneration()
+	cached, _ := getCachedObjects(e, emailId, resource, action)
+	// decisions of vals reached so far, cached or evaluated, for the audit
+	decisions := make(map[string]bool, len(vals))
+	defer func() {
+		e.auditBatch(emailId, resource, action, vals, decisions)
+	}()
+	var newVals []string
+	for _, item := range vals {
+		if item == "" {
+			return false, item
+		}
+		decision := cached[item]
+		if !decision.known() {
+			newVals = append(newVals, item)
+			continue
+		}
+		decisions[item] = decision.allowed()
+		if !decision.allowed() {
+			return false, item
+		}
+	}
+	if e.Cache != nil {
+		e.recordCacheLookup(len(vals)-len(newVals), len(newVals))
+	}
+	if len(newVals) == 0 {
+		return true, ""
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batchSize := getBatchSize()
+	if batchSize > len(newVals) {
+		batchSize = len(newVals)
+	}
+	result := make(map[string]bool, len(newVals))
+	// denied rather than firstDenied != "" tells whether an object was denied, firstDenied may be empty
+	denied := false
+	mutex := &sync.Mutex{}
+	wg := new(sync.WaitGroup)
+	for i := 0; i < batchSize; i++ {
+		if !e.acquireBatchSlot(ctx) {
+			// a denial was found while waiting
+			break
+		}
+		wg.Add(1)
+		go func(batch []string) {
+			defer wg.Done()
+			defer e.releaseBatchSlot()
+			for _, item := range batch {
+				if ctx.Err() != nil {
+					return
+				}
+				allowed, err := e.enforceByEmailE(e.Enforcer, emailId, resource, action, item)
+				mutex.Lock()
+				if err == nil {
+					result[item] = allowed
+				}
+				if (!allowed || err != nil) && !denied {
+					denied = true
+					firstDenied = item
+					cancel()
+				}
+				mutex.Unlock()
+			}
+		}(newVals[i*len(newVals)/batchSize : (i+1)*len(newVals)/batchSize])
+	}
+	wg.Wait()
+	for item, allowed := range result {
+		decisions[item] = allowed
+	}
+	storeCacheDataAt(e, generation, emailId, resource, action, result)
+	return !denied, firstDenied
+}
+
+// WarmUser evaluates and caches the decisions of emailId for every action of resources over the resource's
+// objects, e.g. on login so that the first page load is served from the cache. It blocks until all are cached
+// and is meant to be run in its own goroutine, it returns right away when the cache is disabled. Nothing is cached
+// when emailId is rate limited, see EnforceByEmailMixedBatch
+func (e *EnforcerImpl) WarmUser(emailId string, resources []string, actions []string, objects map[string][]string) error {
+	if e.Cache == nil {
+		return nil
+	}
+	var checks []ResourceActionObject
+	for _, resource := range resources {
+		for _, action := range actions {
+			for _, object := range objects[resource] {
+				checks = append(checks, ResourceActionObject{Resource: resource, Action: action, Object: object})
+			}
+		}
+	}
+	_, err := e.EnforceByEmailMixedBatch(emailId, checks)
+	return err
+}
+
+// ObjectAction is a single check of EnforceByEmailPerObjectAction
+type ObjectAction struct {
+	Object string
+	Action string
+}
+
+// EnforceByEmailPerObjectAction is EnforceByEmailMixedBatch for checks of one resource, each object needing its
+// own action. An object listed with more than one action is allowed only if all of them are
+func (e *EnforcerImpl) EnforceByEmailPerObjectAction(emailId string, resource string, items []ObjectAction) (map[string]bool, error) {
+	checks := make([]ResourceActionObject, len(items))
+	for i, item := range items {
+		checks[i] = ResourceActionObject{Resource: resource, Action: item.Action, Object: item.Object}
+	}
+	decisions, err := e.EnforceByEmailMixedBatch(emailId, checks)
+	if err != nil {
+		return map[string]bool{}, err
+	}
+	result := make(map[string]bool, len(items))
+	for _, check := range checks {
+		allowed, found := result[check.Object]
+		result[check.Object] = decisions[check] && (allowed || !found)
+	}
+	return result, nil
+}
+
+// EnforceByEmailInBatchWithProgress is same as EnforceByEmailInBatch but calls progress, from one goroutine at a
+// time, each time a part of the batch completes. Objects found in the cache are reported done on first call.
+// Requests with progress are never coalesced by ENFORCER_BATCH_SINGLE_FLIGHT
+func (e *EnforcerImpl) EnforceByEmailInBatchWithProgress(emailId string, resource string, action string, vals []string, progress func(done, total int)) map[string]bool {
+	result, _, _ := e.enforceByEmailInBatch(context.Background(), emailId, resource, action, vals, getBatchSize(), progress)
+	return result
+}
+
+// EnforceByEmailInBatchN is same as EnforceByEmailInBatch but lets the caller pick the number of goroutines,
+// bounded by EnforcerBatchMaxSize. Configured batch size is used when concurrency <= 0
+func (e *EnforcerImpl) EnforceByEmailInBatchN(emailId string, resource string, action string, vals []string, concurrency int) map[string]bool {
+	if concurrency <= 0 {
+		concurrency = getBatchSize()
+	}
+	if concurrency > EnforcerBatchMaxSize {
+		concurrency = EnforcerBatchMaxSize
+	}
+	result, _, _ := e.enforceByEmailInBatch(context.Background(), emailId, resource, action, vals, concurrency, nil)
+	return result
+}
+
+// ValidateObjectSegments checks that every object has the "/" separated segment count registered for the resource
+// in resourceObjectSegmentCount, or for other resources, that all objects agree on a segment count. MatchKeyByPart
+// denies objects whose segment count differs from the policy, so a mismatch would otherwise be a silent deny
+func ValidateObjectSegments(resource string, vals []string) error {
+	expectedCount, registered := resourceObjectSegmentCount[resource]
+	for i, val := range vals {
+		count := strings.Count(val, "/") + 1
+		if !registered && i == 0 {
+			expectedCount = count
+			continue
+		}
+		if count != expectedCount {
+			return status.Errorf(codes.InvalidArgument, "object %q of resource %s has %d segments, expected %d", val, resource, count, expectedCount)
+		}
+	}
+	return nil
+}
+
+func getBatchSize() int {
+	enforcerMaxBatchSize := os.Getenv("ENFORCER_MAX_BATCH_SIZE")
+	batchSize, err := strconv.Atoi(enforcerMaxBatchSize)
+	if err != nil || batchSize <= 0 {
+		batchSize = EnforcerBatchDefaultSize
+	}
+	return batchSize
+}
+
+// enforceByEmailInBatch is the batch engine, along with the results it returns the errors of objects whose
+// evaluation failed and ctx's error if the batch was stopped before completion. vals belongs to the caller and is never
+// written to, objects left to evaluate after the cache lookup are collected into a new slice
+func (e *EnforcerImpl) enforceByEmailInBatch(ctx context.Context, emailId string, resource string, action string, vals []string, batchSize int, progress func(done, total int)) (map[string]bool, map[string]error, error) {
+	return e.enforceByEmailInBatchInto(ctx, nil, emailId, resource, action, vals, batchSize, progress)
+}
+
+// enforceByEmailInBatchInto is enforceByEmailInBatch filling dst, when not nil, instead of a new map
+func (e *EnforcerImpl) enforceByEmailInBatchInto(ctx context.Context, dst map[string]bool, emailId string, resource string, action string, vals []string, batchSize int, progress func(done, total int)) (map[string]bool, map[string]error, error) {
+	e.recordBatchSize(len(vals))
+	if action == "" {
+		action = e.config.DefaultAction
+	}
+	resource, action = e.normalizeKeys(resource, action)
+	if e.config.BatchTimeoutInMs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(e.config.BatchTimeoutInMs)*time.Millisecond)
+		defer cancel()
+	}
+	if err := e.checkBatch(ctx, emailId, resource, action, len(vals)); err != nil {
+		return map[string]bool{}, nil, err
+	}
+	vals, emptyCount := withoutEmptyObjects(vals)
+	if emptyCount > 0 {
+		e.logger.Warnw("skipping empty objects of batch enforcement", "emailId", emailId, "resource", resource,
+			"action", action, "empty", emptyCount)
+	}
+	var result map[string]bool
+	var objectErrs map[string]error
+	var err error
+	if dst != nil {
+		// dst is the caller's, it can't be shared among coalesced requests
+		result, objectErrs, err = e.evaluateBatch(ctx, dst, emailId, resource, action, vals, batchSize, newBatchProgress(progress, len(vals)))
+	} else {
+		result, objectErrs, err = e.coalesceBatch(ctx, emailId, resource, action, vals, batchSize, progress)
+	}
+	e.auditBatch(emailId, resource, action, vals, result)
+	if emptyCount > 0 {
+		// empty objects are never results, the detailed variant reports them as invalid through their error
+		withEmpty := make(map[string]error, len(objectErrs)+1)
+		for k, v := range objectErrs {
+			withEmpty[k] = v
+		}
+		withEmpty[""] = status.Error(codes.InvalidArgument, "empty object")
+		objectErrs = withEmpty
+	}
+	return result, objectErrs, err
+}
+
+// checkBatch runs the checks every batch passes before evaluation: emailId, resource and action are required, the
+// resource must be known, emailId within its rate limit and the initial policy loaded
+func (e *EnforcerImpl) checkBatch(ctx context.Context, emailId string, resource string, action string, size int) error {
+	if emailId == "" || resource == "" || action == "" {
+		// results would be meaningless and get cached under a malformed key
+		e.logger.Warnw("skipping batch enforcement with missing input", "emailId", emailId, "resource", resource,
+			"action", action, "size", size)
+		return status.Error(codes.InvalidArgument, "emailId, resource and action are required for batch enforcement")
+	}
+	if err := e.checkResource(resource); err != nil {
+		e.logger.Errorw("skipping batch enforcement of unknown resource", "emailId", emailId, "resource", resource,
+			"action", action, "size", size)
+		return err
+	}
+	if err := e.checkSubjectRateLimit(ctx, emailId); err != nil {
+		e.logger.Warnw("skipping batch enforcement over the subject's rate limit", "emailId", emailId, "resource", resource,
+			"action", action, "size", size)
+		return err
+	}
+	if err := e.waitPolicyLoaded(ctx); err != nil {
+		e.logger.Errorw("skipping batch enforcement before policy load", "emailId", emailId, "resource", resource,
+			"action", action, "size", size)
+		return err
+	}
+	return nil
+}
+
+// withoutEmptyObjects returns vals without its empty objects and their count, vals itself when it has none
+func withoutEmptyObjects(vals []string) ([]string, int) {
+	emptyCount := 0
+	for _, item := range vals {
+		if item == "" {
+			emptyCount++
+		}
+	}
+	if emptyCount == 0 {
+		return vals, 0
+	}
+	nonEmpty := make([]string, 0, len(vals)-emptyCount)
+	for _, item := range vals {
+		if item != "" {
+			nonEmpty = append(nonEmpty, item)
+		}
+	}
+	return nonEmpty, emptyCount
+}
+
+// coalesceBatch evaluates the batch, sharing one evaluation among concurrent identical requests when
+// ENFORCER_BATCH_SINGLE_FLIGHT is set
+func (e *EnforcerImpl) coalesceBatch(ctx context.Context, emailId string, resource string, action string, vals []string, batchSize int, progress func(done, total int)) (map[string]bool, map[string]error, error) {
+	if !e.config.BatchSingleFlight || progress != nil {
+		return e.evaluateBatch(ctx, nil, emailId, resource, action, vals, batchSize, newBatchProgress(progress, len(vals)))
+	}
+	// concurrent identical requests share one evaluation, governed by the ctx of the request which started it
+	value, _, _ := e.batchGroup.Do(getBatchFlightKey(emailId, resource, action, vals), func() (interface{}, error) {
+		result, objectErrs, err := e.evaluateBatch(ctx, nil, emailId, resource, action, vals, batchSize, nil)
+		return batchOutcome{result: result, objectErrs: objectErrs, err: err}, nil
+	})
+	outcome := value.(batchOutcome)
+	result := make(map[string]bool, len(outcome.result))
+	for k, v := range outcome.result {
+		result[k] = v
+	}
+	return result, outcome.objectErrs, outcome.err
+}
 
+type batchOutcome struct {
+	result     map[string]bool
+	objectErrs map[string]error
+	err        error
 }
 
-func (e *EnforcerImpl) EnforceByEmailInBatch(emailId string, resource string, action string, vals []string) map[string]bool {
+func getBatchFlightKey(emailId string, resource string, action string, vals []string) string {
+	hash := sha256.New()
+	for _, item := range vals {
+		hash.Write([]byte(item))
+		hash.Write([]byte{0})
+	}
+	return emailId + "$$" + getCacheKey("", resource, action) + "$$" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// evaluateBatch evaluates the objects of vals missing from the cache. Results are written to dst, when dst is nil
+// to a new map also holding the other cached objects of resource and action
+func (e *EnforcerImpl) evaluateBatch(ctx context.Context, dst map[string]bool, emailId string, resource string, action string, vals []string, batchSize int, progress *batchProgress) (map[string]bool, map[string]error, error) {
 	var totalTimeGap int64 = 0
 	var maxTimegap int64 = 0
 	var minTimegap int64 = math.MaxInt64
 	var avgTimegap float64
-	enforcerMaxBatchSize := os.Getenv("ENFORCER_MAX_BATCH_SIZE")
-	batchSize, err := strconv.Atoi(enforcerMaxBatchSize)
-	if err != nil {
-		batchSize = EnforcerBatchDefaultSize
-		err = nil
-	}
 	var result map[string]bool
+	var objectErrs = make(map[string]error)
 	var metrics = make(map[int]int64)
+	batchStart := time.Now()
+	generation := e.PolicyGeneration()
 
-	enforcerCacheMutex := getEnforcerCacheLock(e, emailId)
-	enforcerCacheMutex.Lock()
-	defer clearCacheLock(e, emailId, enforcerCacheMutex)
-
-	result = getCacheData(e, emailId, resource, action)
+	if dst != nil {
+		objectResult, found := getCachedObjects(e, emailId, resource, action)
+		for _, item := range vals {
+			if decision := objectResult[item]; decision.known() {
+				dst[item] = decision.allowed()
+			}
+		}
+		if found {
+			result = dst
+		}
+	} else {
+		result = getCacheData(e, emailId, resource, action)
+	}
 	if result != nil {
 		e.logger.Infow("enforce request for batch with data from cache", "emailId", emailId, "resource", resource,
 			"action", action, "size", len(vals), "cached", "true")
@@ -160,27 +1190,64 @@ func (e *EnforcerImpl) EnforceByEmailInBatch(emailId string, resource string, ac
 				newVals = append(newVals, item)
 			}
 		}
+		progress.advance(len(vals) - len(newVals))
+		e.recordCacheLookup(len(vals)-len(newVals), len(newVals))
 		vals = newVals
 	} else {
-		result = make(map[string]bool)
+		result = dst
+		if result == nil {
+			result = make(map[string]bool)
+		}
+		if e.Cache != nil {
+			e.recordCacheLookup(0, len(vals))
+		}
+	}
+
+	if len(vals) > 0 && e.allowsEveryObject(strings.ToLower(emailId), resource) {
+		e.logger.Debugw("allowing batch through wildcard action and object grant", "emailId", emailId,
+			"resource", resource, "action", action, "size", len(vals))
+		for _, item := range vals {
+			result[item] = true
+		}
+		progress.advance(len(vals))
+		vals = nil
 	}
 
 	totalSize := len(vals)
-	wg := new(sync.WaitGroup)
-	var batchMutex = &sync.RWMutex{}
 	if batchSize > totalSize {
 		batchSize = totalSize
 	}
-	wg.Add(batchSize)
-	for i := 0; i < batchSize; i++ {
-		startIndex := i * totalSize / batchSize
-		endIndex := startIndex + totalSize/batchSize
-		if endIndex > totalSize {
-			endIndex = totalSize
+	if totalSize <= e.config.BatchSyncThreshold {
+		// fanning out costs more than evaluating a few objects on the calling goroutine
+		start := time.Now()
+		syncResult, syncErrs := e.enforceObjects(ctx, emailId, resource, action, vals)
+		for k, v := range syncResult {
+			result[k] = v
+		}
+		objectErrs = syncErrs
+		metrics[0] = time.Since(start).Milliseconds()
+		progress.advance(len(vals))
+	} else {
+		wg := new(sync.WaitGroup)
+		var batchMutex = &sync.RWMutex{}
+		for i := 0; i < batchSize; i++ {
+			if !e.acquireBatchSlot(ctx) {
+				// the remaining parts are left unevaluated like those of goroutines finding ctx done
+				break
+			}
+			startIndex := i * totalSize / batchSize
+			endIndex := (i + 1) * totalSize / batchSize
+			wg.Add(1)
+			go func(index int, part []string) {
+				defer e.releaseBatchSlot()
+				e.enforceByEmailInBatchSync(ctx, wg, batchMutex, result, objectErrs, metrics, progress, index, emailId, resource, action, part)
+			}(i, vals[startIndex:endIndex])
 		}
-		go EnforceByEmailInBatchSync(e, wg, batchMutex, result, metrics, i, emailId, resource, action, vals[startIndex:endIndex])
+		wg.Wait()
+	}
+	if totalSize > 0 {
+		e.recordBatchDurations(metrics)
 	}
-	wg.Wait()
 	for _, duration := range metrics {
 		totalTimeGap += duration
 		if duration > maxTimegap {
@@ -191,116 +1258,697 @@ func (e *EnforcerImpl) EnforceByEmailInBatch(emailId string, resource string, ac
 		}
 	}
 
-	storeCacheData(e, emailId, resource, action, result)
+	if e.config.BatchSingleFlight {
+		// results are stored below, later batches find them in the cache
+		defer e.releaseObjectFlights(strings.ToLower(emailId), resource, action, vals)
+	}
+	if len(objectErrs) == 0 {
+		storeCacheDataAt(e, generation, emailId, resource, action, result)
+	} else {
+		e.logger.Errorw("error in enforcing objects of batch", "emailId", emailId, "resource", resource,
+			"action", action, "failed", len(objectErrs))
+		storeResult := make(map[string]bool, len(result))
+		for object, allowed := range result {
+			if _, failed := objectErrs[object]; !failed {
+				storeResult[object] = allowed
+			}
+		}
+		storeCacheDataAt(e, generation, emailId, resource, action, storeResult)
+	}
 
 	if batchSize > 0 {
 		avgTimegap = float64(totalTimeGap / int64(batchSize))
 	}
-	e.logger.Infow("enforce request for batch with data", "emailId", emailId, "resource", resource,
-		"action", action, "totalElapsedTime", totalTimeGap, "maxTimegap", maxTimegap, "minTimegap",
+	logBatch, message := e.logger.Infow, "enforce request for batch with data"
+	elapsed := time.Since(batchStart)
+	if threshold := time.Duration(e.config.SlowEnforcementThresholdInMs) * time.Millisecond; threshold > 0 {
+		logBatch = e.logger.Debugw
+		if elapsed >= threshold {
+			logBatch, message = e.logger.Warnw, "slow enforce request for batch"
+		}
+	}
+	logBatch(message, "emailId", emailId, "resource", resource,
+		"action", action, "elapsedTime", elapsed.Milliseconds(), "totalElapsedTime", totalTimeGap, "maxTimegap", maxTimegap, "minTimegap",
 		minTimegap, "avgTimegap", avgTimegap, "size", len(vals), "batchSize", batchSize, "cached", e.Cache != nil)
 
-	return result
+	if err := ctx.Err(); err != nil {
+		e.logger.Warnw("batch enforcement stopped before completion", "emailId", emailId, "resource", resource,
+			"action", action, "size", len(vals), "resultSize", len(result), "err", err)
+		return result, objectErrs, err
+	}
+	return result, objectErrs, nil
+}
+
+// GetAllowedObjectsSorted returns the subset of candidates allowed for the user in ascending order
+func (e *EnforcerImpl) GetAllowedObjectsSorted(emailId string, resource string, action string, candidates []string) []string {
+	result := e.EnforceByEmailInBatch(emailId, resource, action, candidates)
+	allowed := make([]string, 0, len(candidates))
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		if result[candidate] && !seen[candidate] {
+			seen[candidate] = true
+			allowed = append(allowed, candidate)
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// AllowedActions returns the subset of actions allowed for the user on object in the order of actions, e.g. for
+// building context menus. Each action is a batch of its own, evaluated concurrently and cached, see
+// EnforceByEmailMixedBatch for its errors
+func (e *EnforcerImpl) AllowedActions(emailId string, resource string, object string, actions []string) ([]string, error) {
+	checks := make([]ResourceActionObject, len(actions))
+	for i, action := range actions {
+		checks[i] = ResourceActionObject{Resource: resource, Action: action, Object: object}
+	}
+	result, err := e.EnforceByEmailMixedBatch(emailId, checks)
+	if err != nil {
+		return []string{}, err
+	}
+	allowed := make([]string, 0, len(actions))
+	seen := make(map[string]bool)
+	for _, check := range checks {
+		if result[check] && !seen[check.Action] {
+			seen[check.Action] = true
+			allowed = append(allowed, check.Action)
+		}
+	}
+	return allowed, nil
+}
+
+// cacheLock is the per email lock guarding read-modify-write of the email's cache entry,
+// refCount tracks holders and waiters so the lock is only dropped from the map once unused
+type cacheLock struct {
+	// held has a value while the lock is held, a channel rather than a mutex so that waiting can time out
+	held     chan struct{}
+	refCount int
+}
+
+func newCacheLock() *cacheLock {
+	return &cacheLock{held: make(chan struct{}, 1)}
+}
+
+func (l *cacheLock) Lock() {
+	l.held <- struct{}{}
+}
+
+func (l *cacheLock) TryLock() bool {
+	select {
+	case l.held <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// lockWithin locks l unless it is held for longer than timeout, reporting whether it was locked
+func (l *cacheLock) lockWithin(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case l.held <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (l *cacheLock) Unlock() {
+	<-l.held
 }
 
-func getEnforcerCacheLock(e *EnforcerImpl, emailId string) *sync.Mutex {
-	enforcerCacheMutex, found := e.lock[getLockKey(emailId)]
+func getEnforcerCacheLock(e *EnforcerImpl, emailId string) *cacheLock {
+	shard := e.shardOf(emailId)
+	shard.lockMapMutex.Lock()
+	defer shard.lockMapMutex.Unlock()
+	enforcerCacheMutex, found := shard.lock[getLockKey(emailId)]
 	if !found {
-		enforcerCacheMutex = &sync.Mutex{}
-		e.lock[getLockKey(emailId)] = enforcerCacheMutex
+		enforcerCacheMutex = newCacheLock()
+		shard.lock[getLockKey(emailId)] = enforcerCacheMutex
 	}
+	enforcerCacheMutex.refCount++
 	return enforcerCacheMutex
 }
 
-func clearCacheLock(e *EnforcerImpl, emailId string, cacheMutex *sync.Mutex) {
+func clearCacheLock(e *EnforcerImpl, emailId string, cacheMutex *cacheLock) {
 	cacheMutex.Unlock()
-	delete(e.lock, getLockKey(emailId))
+	dropCacheLock(e, emailId, cacheMutex)
+}
+
+// dropCacheLock releases the reference of getEnforcerCacheLock to a lock which could not be acquired
+func dropCacheLock(e *EnforcerImpl, emailId string, cacheMutex *cacheLock) {
+	shard := e.shardOf(emailId)
+	shard.lockMapMutex.Lock()
+	defer shard.lockMapMutex.Unlock()
+	cacheMutex.refCount--
+	if cacheMutex.refCount == 0 {
+		delete(shard.lock, getLockKey(emailId))
+	}
+}
+
+// cacheDecision is a cached decision of an object. Negative results are cached as decisionDeny, decisionUnknown,
+// the zero value, is what objects without a cached decision read as, so a missing object is never taken for a deny
+type cacheDecision int8
+
+const (
+	decisionUnknown cacheDecision = iota
+	decisionDeny
+	decisionAllow
+)
+
+func toCacheDecision(allowed bool) cacheDecision {
+	if allowed {
+		return decisionAllow
+	}
+	return decisionDeny
+}
+
+// known tells whether the decision was cached, allowed is only meaningful for known decisions
+func (d cacheDecision) known() bool {
+	return d != decisionUnknown
+}
+
+func (d cacheDecision) allowed() bool {
+	return d == decisionAllow
 }
 
 func getCacheData(e *EnforcerImpl, emailId string, resource string, action string) map[string]bool {
-	if e.Cache == nil {
+	objectResult, found := getCachedObjects(e, emailId, resource, action)
+	if !found {
 		return nil
 	}
-	emailResult, found := e.Cache.Get(emailId)
-	if found {
-		e.Cache.Set(emailId, emailResult, cache.DefaultExpiration)
-		emailResultMap := emailResult.(map[string]map[string]bool)
-		return emailResultMap[getCacheKey(resource, action)]
+	// returning a copy, callers merge their results into it and store it back through storeCacheData
+	result := make(map[string]bool, len(objectResult))
+	for object, decision := range objectResult {
+		if decision.known() {
+			result[object] = decision.allowed()
+		}
 	}
-	return nil
+	return result
+}
+
+// IsCached tells whether the decision of emailId for resource, action and object would be served from the cache.
+// Unlike enforcement it neither evaluates the object nor restarts the expiration of the email's cache entry
+func (e *EnforcerImpl) IsCached(emailId string, resource string, action string, object string) bool {
+	emailCache := e.cacheOf(emailId)
+	if emailCache == nil {
+		return false
+	}
+	// entries are replaced rather than modified, reading one needs no lock
+	emailResult, found := emailCache.Get(emailId)
+	if !found {
+		return false
+	}
+	entry, ok := emailResult.(emailCacheEntry)
+	if !ok || entry.generation != e.PolicyGeneration() {
+		return false
+	}
+	return entry.results[e.cacheKey(resource, action)][object].known()
+}
+
+// getCachedObject returns the cached result of a single object, looked up without copying the resource and
+// action's results
+func getCachedObject(e *EnforcerImpl, emailId string, resource string, action string, object string) (allowed bool, found bool) {
+	decision := getCachedDecision(e, emailId, resource, action, object)
+	return decision.allowed(), decision.known()
+}
+
+// getCachedDecision returns the cached decision of a single object, decisionUnknown if there is none
+func getCachedDecision(e *EnforcerImpl, emailId string, resource string, action string, object string) cacheDecision {
+	objectResult, _ := getCachedObjects(e, emailId, resource, action)
+	return objectResult[object]
+}
+
+// getCachedObjects returns the cached decisions of a resource and action, the returned map must not be modified.
+// storeCacheData never writes into a stored map, so reading it after the email's lock is released is safe
+func getCachedObjects(e *EnforcerImpl, emailId string, resource string, action string) (map[string]cacheDecision, bool) {
+	emailCache := e.cacheOf(emailId)
+	if emailCache == nil {
+		return nil, false
+	}
+	cacheMutex := getEnforcerCacheLock(e, emailId)
+	if !e.acquireCacheLockWithin(cacheMutex) {
+		// a slow cache must not hold enforcement, the objects are evaluated as if they were not cached
+		e.logger.Warnw("cache read timed out, evaluating without the cache", "emailId", emailId, "resource", resource, "action", action)
+		dropCacheLock(e, emailId, cacheMutex)
+		return nil, false
+	}
+	defer clearCacheLock(e, emailId, cacheMutex)
+	emailResult, found := emailCache.Get(emailId)
+	if !found {
+		return nil, false
+	}
+	entry, ok := emailResult.(emailCacheEntry)
+	if !ok {
+		e.logger.Warnw("ignoring cache entry of unexpected type", "emailId", emailId, "type", fmt.Sprintf("%T", emailResult))
+		return nil, false
+	}
+	if entry.generation != e.PolicyGeneration() {
+		// evaluated before the last policy reload
+		return nil, false
+	}
+	if e.config.SlidingExpiration {
+		emailCache.Set(emailId, emailResult, cache.DefaultExpiration)
+	}
+	objectResult, found := entry.results[e.cacheKey(resource, action)]
+	return objectResult, found
 }
 
 func storeCacheData(e *EnforcerImpl, emailId string, resource string, action string, result map[string]bool) {
-	if e.Cache == nil {
+	storeCacheDataAt(e, e.PolicyGeneration(), emailId, resource, action, result)
+}
+
+// storeCacheDataAt is storeCacheData for results evaluated under generation, they are dropped if the policy was
+// reloaded since
+func storeCacheDataAt(e *EnforcerImpl, generation uint64, emailId string, resource string, action string, result map[string]bool) {
+	storeCacheEntries(e, generation, emailId, map[string]map[string]bool{e.cacheKey(resource, action): result})
+}
+
+// PrimeCacheBatch merges decisions into the cache of emailId under a single lock. entries is keyed by resource
+// and action joined as resource + "$$" + action, the inner maps hold the decision of each object
+func (e *EnforcerImpl) PrimeCacheBatch(emailId string, entries map[string]map[string]bool) {
+	generation := e.PolicyGeneration()
+	if e.config.CacheNamespace == "" {
+		storeCacheEntries(e, generation, emailId, entries)
 		return
 	}
-	emailResult, found := e.Cache.Get(emailId)
-	if !found {
-		emailResult = make(map[string]map[string]bool)
+	namespaced := make(map[string]map[string]bool, len(entries))
+	for key, result := range entries {
+		namespaced[e.config.CacheNamespace+"##"+key] = result
+	}
+	storeCacheEntries(e, generation, emailId, namespaced)
+}
+
+// storeCacheEntries merges results, keyed by getCacheKey and evaluated under generation, into the cache entry of
+// emailId. Entries of an older generation are replaced instead of merged
+func storeCacheEntries(e *EnforcerImpl, generation uint64, emailId string, results map[string]map[string]bool) {
+	emailCache := e.cacheOf(emailId)
+	if emailCache == nil {
+		return
+	}
+	cacheMutex := getEnforcerCacheLock(e, emailId)
+	if !e.acquireCacheLockWithin(cacheMutex) {
+		e.logger.Warnw("cache store timed out, dropping the results", "emailId", emailId)
+		dropCacheLock(e, emailId, cacheMutex)
+		return
+	}
+	defer clearCacheLock(e, emailId, cacheMutex)
+	if generation != e.PolicyGeneration() {
+		// the policy was reloaded while evaluating, results may be stale
+		return
+	}
+	// building a new entry instead of writing into the cached maps, readers may still hold references to them
+	emailResultMap := make(map[string]map[string]cacheDecision)
+	if emailResult, found := emailCache.Get(emailId); found {
+		previous, ok := emailResult.(emailCacheEntry)
+		if !ok {
+			// replacing the entry, nothing of an unexpected value can be kept
+			e.logger.Warnw("replacing cache entry of unexpected type", "emailId", emailId, "type", fmt.Sprintf("%T", emailResult))
+		}
+		if previous.generation == generation {
+			for key, value := range previous.results {
+				emailResultMap[key] = value
+			}
+		}
+	}
+	for cacheKey, result := range results {
+		objectResult := make(map[string]cacheDecision, len(emailResultMap[cacheKey])+len(result))
+		for object, decision := range emailResultMap[cacheKey] {
+			objectResult[object] = decision
+		}
+		for object, allowed := range result {
+			objectResult[object] = toCacheDecision(allowed)
+		}
+		emailResultMap[cacheKey] = objectResult
 	}
-	emailResult.(map[string]map[string]bool)[getCacheKey(resource, action)] = result
-	e.Cache.Set(emailId, emailResult, cache.DefaultExpiration)
+	emailCache.Set(emailId, emailCacheEntry{generation: generation, results: emailResultMap}, cache.DefaultExpiration)
+	e.recordCacheStore(emailId, results)
 }
 
-func getCacheKey(resource string, action string) string {
+// getCacheKey builds the key of a resource and action's results within an email's cache entry, namespace keeps
+// results of enforcers sharing a backing cache apart
+func getCacheKey(namespace string, resource string, action string) string {
+	if namespace != "" {
+		return namespace + "##" + resource + "$$" + action
+	}
 	return resource + "$$" + action
 }
 
+// cacheKey is the key the results of resource and action are cached under in an email's entry
+func (e *EnforcerImpl) cacheKey(resource string, action string) string {
+	resource, action = e.normalizeKeys(resource, action)
+	return getCacheKey(e.config.CacheNamespace, resource, action)
+}
+
+// normalizeKeys lower cases resource and action with ENFORCER_CASE_INSENSITIVE_KEYS
+func (e *EnforcerImpl) normalizeKeys(resource string, action string) (string, string) {
+	if !e.config.CaseInsensitiveKeys {
+		return resource, action
+	}
+	return strings.ToLower(resource), strings.ToLower(action)
+}
+
 func getLockKey(emailId string) string {
 	return emailId
 }
 
 func (e *EnforcerImpl) InvalidateCache(emailId string) bool {
+	invalidated, err := e.InvalidateCacheWithContext(context.Background(), emailId)
+	if err != nil {
+		e.logger.Errorw("error in publishing cache invalidation", "emailId", emailId, "err", err)
+	}
+	return invalidated
+}
+
+func (e *EnforcerImpl) InvalidateCompleteCache() {
+	if err := e.InvalidateCompleteCacheWithContext(context.Background()); err != nil {
+		e.logger.Errorw("error in publishing complete cache invalidation", "err", err)
+	}
+}
+
+func (e *EnforcerImpl) invalidateLocalCache(emailId string) bool {
+	atomic.AddUint64(&e.invalidations, 1)
 	cacheLock := getEnforcerCacheLock(e, emailId)
-	cacheLock.Lock()
+	e.acquireCacheLock(cacheLock)
 	defer clearCacheLock(e, emailId, cacheLock)
-	if e.Cache != nil {
-		e.Cache.Delete(emailId)
+	if emailCache := e.cacheOf(emailId); emailCache != nil {
+		emailCache.Delete(emailId)
+		e.recordCacheInvalidation(emailId)
 		return true
 	}
 	return false
 }
 
-func (e *EnforcerImpl) InvalidateCompleteCache() {
-	if e.Cache != nil {
-		e.Cache.Flush()
+func (e *EnforcerImpl) invalidateLocalCompleteCache() {
+	atomic.AddUint64(&e.invalidations, 1)
+	for _, shardCache := range e.caches() {
+		shardCache.Flush()
+	}
+	e.recordCompleteCacheInvalidation()
+}
+
+// AddDenyPolicy adds an explicit deny, which overrides matching allows under the deny-override effect of the
+// predefined model, and drops the cached decisions it may change. A deny on a role or on the "*" subject
+// invalidates the complete cache as it applies to the role's members or to every subject
+func (e *EnforcerImpl) AddDenyPolicy(subject string, resource string, action string, object string) bool {
+	subject = strings.ToLower(subject)
+	added := e.Enforcer.AddPolicy(subject, strings.ToLower(resource), strings.ToLower(action), strings.ToLower(object), "deny")
+	if users, _ := e.getUsersForRole(subject); subject == "*" || len(users) > 0 {
+		e.InvalidateCompleteCache()
+	} else {
+		e.InvalidateCache(subject)
+	}
+	return added
+}
+
+// InvalidateBySubjectPrefix drops cache entries only for the emails starting with prefix, it is
+// meant for policy reloads where the affected subjects are known, avoiding a complete flush
+func (e *EnforcerImpl) InvalidateBySubjectPrefix(prefix string) {
+	for _, shardCache := range e.caches() {
+		for emailId := range shardCache.Items() {
+			if strings.HasPrefix(emailId, prefix) {
+				e.InvalidateCache(emailId)
+			}
+		}
+	}
+}
+
+// InvalidateRole drops the cache entries of the users holding role, directly or through the roles inheriting it,
+// e.g. after the role's policies changed. Policies of "*" and of ENFORCER_DEFAULT_ROLE apply to every user, their
+// change drops the complete cache, as does a change before role links are built, the users can't be resolved then
+func (e *EnforcerImpl) InvalidateRole(role string) {
+	role = strings.ToLower(role)
+	if role == "*" || (e.config.DefaultRole != "" && role == strings.ToLower(e.config.DefaultRole)) {
+		e.InvalidateCompleteCache()
+		return
+	}
+	visited := map[string]bool{role: true}
+	pending := []string{role}
+	for len(pending) > 0 {
+		subject := pending[0]
+		pending = pending[1:]
+		users, ok := e.getUsersForRole(subject)
+		if !ok {
+			e.logger.Warnw("role links not built, dropping the complete cache for the role", "role", role)
+			e.InvalidateCompleteCache()
+			return
+		}
+		for _, user := range users {
+			if !visited[user] {
+				visited[user] = true
+				pending = append(pending, user)
+			}
+		}
+	}
+	for subject := range visited {
+		e.InvalidateCache(subject)
+	}
+}
+
+// CacheEnabled tells whether enforce results are being cached, controlled by ENFORCER_CACHE
+func (e *EnforcerImpl) CacheEnabled() bool {
+	return e.Cache != nil
+}
+
+// CachedEmails lists the emails having live cache entries in sorted order, unlike getCacheData it leaves
+// their expiration untouched
+func (e *EnforcerImpl) CachedEmails() []string {
+	if e.Cache == nil {
+		return nil
+	}
+	emailIds := make([]string, 0)
+	for _, shardCache := range e.caches() {
+		for emailId := range shardCache.Items() {
+			emailIds = append(emailIds, emailId)
+		}
 	}
+	sort.Strings(emailIds)
+	return emailIds
 }
 
 // enforce is a helper to additionally check a default role and invoke a custom claims enforcement function
 func (e *EnforcerImpl) enforce(enf *casbin.Enforcer, rvals ...interface{}) bool {
+	start := time.Now()
+	enforcedStatus, subject, _ := e.enforceResolve(enf, rvals...)
+	if e.config.SlowEnforcementThresholdInMs > 0 && len(rvals) > 0 {
+		// the token is logged as the subject it resolved to, rvals still hold it when resolution failed
+		e.logSlowEnforcement(start, append([]interface{}{subject}, rvals[1:]...))
+	}
+	return enforcedStatus
+}
+
+// enforceE is enforce which also returns a codes.Unauthenticated error when the token can't be verified
+func (e *EnforcerImpl) enforceE(enf *casbin.Enforcer, rvals ...interface{}) (bool, error) {
+	enforcedStatus, _, err := e.enforceResolve(enf, rvals...)
+	return enforcedStatus, err
+}
+
+// enforceResolve is enforceE which also returns the subject the token was resolved to, empty when the token
+// fails verification
+func (e *EnforcerImpl) enforceResolve(enf *casbin.Enforcer, rvals ...interface{}) (bool, string, error) {
 	// check the default role
 	if len(rvals) == 0 {
-		return false
+		return false, "", nil
+	}
+	token, _ := rvals[0].(string)
+	if token == "" && e.config.AllowAnonymous {
+		return e.enforceAnonymous(enf, rvals...)
 	}
-	claims, err := e.SessionManager.VerifyToken(rvals[0].(string))
+	verifyStart := time.Now()
+	mapClaims, err := e.verifyToken(token)
+	verifyDuration := time.Since(verifyStart)
 	if err != nil {
-		return false
+		return false, "", unauthenticatedErr(err)
+	}
+	subject := e.resolveSubject(mapClaims)
+	if subject == "" {
+		// neither an email nor a locally issued admin token
+		return false, "", nil
+	}
+	if err := e.checkResourceOf(rvals); err != nil {
+		return false, subject, err
+	}
+	rvals[0] = subject
+	if isSyntheticAdmin(mapClaims) {
+		if allowed, decided := e.principalDecision(subject); decided && !allowed {
+			// the deny list wins over the auto grant
+			e.recordTokenEnforcement(verifyDuration, 0)
+			e.auditDecision(enf, false, rvals...)
+			return false, subject, nil
+		}
+		if e.config.AdminAutoGrant {
+			e.recordTokenEnforcement(verifyDuration, 0)
+			e.auditDecision(enf, true, rvals...)
+			return true, subject, nil
+		}
+		e.warnIfAdminUngranted(subject)
+	}
+	policyStart := time.Now()
+	enforcedStatus, err := e.enforceByEmailCached(enf, rvals...)
+	e.recordTokenEnforcement(verifyDuration, time.Since(policyStart))
+	if err == ErrPolicyNotLoaded {
+		return false, subject, err
 	}
-	mapClaims, err := jwt.MapClaims(claims)
 	if err != nil {
-		return false
+		e.logger.Errorw("panic occurred", "err", err)
+	}
+	e.auditDecision(enf, enforcedStatus, rvals...)
+	return enforcedStatus, subject, nil
+}
+
+// enforceAnonymous is enforceResolve for requests without a token, enforced as ENFORCER_ANONYMOUS_SUBJECT
+func (e *EnforcerImpl) enforceAnonymous(enf *casbin.Enforcer, rvals ...interface{}) (bool, string, error) {
+	subject := getAnonymousSubject(e.config)
+	if subject == "" {
+		return false, "", nil
 	}
-	email := jwt.GetField(mapClaims, "email")
-	sub := jwt.GetField(mapClaims, "sub")
-	if email == "" && (sub == "admin" || sub == "admin:login") {
-		email = "admin"
+	if err := e.checkResourceOf(rvals); err != nil {
+		return false, subject, err
 	}
-	rvals[0] = strings.ToLower(email)
-	defer handlePanic()
-	enforcedStatus := enf.Enforce(rvals...)
-	return enforcedStatus
+	rvals[0] = subject
+	enforcedStatus, err := e.enforceByEmailCached(enf, rvals...)
+	if err == ErrPolicyNotLoaded {
+		return false, subject, err
+	}
+	if err != nil {
+		e.logger.Errorw("panic occurred", "err", err)
+	}
+	e.auditDecision(enf, enforcedStatus, rvals...)
+	return enforcedStatus, subject, nil
 }
 
 // enforce is a helper to additionally check a default role and invoke a custom claims enforcement function
 func (e *EnforcerImpl) enforceByEmail(enf *casbin.Enforcer, rvals ...interface{}) bool {
+	if e.config.SlowEnforcementThresholdInMs > 0 {
+		defer e.logSlowEnforcement(time.Now(), rvals)
+	}
+	enforcedStatus, err := e.enforceByEmailCached(enf, rvals...)
+	if err != nil {
+		e.logger.Errorw("panic occurred", "err", err)
+	}
+	e.auditDecision(enf, enforcedStatus, rvals...)
+	return enforcedStatus
+}
+
+// enforceByEmailCached is enforceByEmailE sharing the batch cache, a single request's object is cached among the
+// results of its email, resource and action so that later batches, and InvalidateCache, see it. Failed
+// evaluations are not cached
+func (e *EnforcerImpl) enforceByEmailCached(enf *casbin.Enforcer, rvals ...interface{}) (bool, error) {
+	if e.config.CaseInsensitiveKeys && len(rvals) == 4 {
+		resource, ok1 := rvals[1].(string)
+		action, ok2 := rvals[2].(string)
+		if ok1 && ok2 {
+			rvals[1], rvals[2] = e.normalizeKeys(resource, action)
+		}
+	}
+	if e.Cache == nil || enf != e.Enforcer || len(rvals) != 4 {
+		return e.enforceByEmailE(enf, rvals...)
+	}
+	emailId, ok1 := rvals[0].(string)
+	resource, ok2 := rvals[1].(string)
+	action, ok3 := rvals[2].(string)
+	object, ok4 := rvals[3].(string)
+	if !ok1 || !ok2 || !ok3 || !ok4 || emailId == "" || resource == "" || action == "" {
+		return e.enforceByEmailE(enf, rvals...)
+	}
+	if allowed, found := getCachedObject(e, emailId, resource, action, object); found {
+		e.recordCacheLookup(1, 0)
+		return allowed, nil
+	}
+	e.recordCacheLookup(0, 1)
+	generation := e.PolicyGeneration()
+	allowed, err := e.enforceByEmailE(enf, rvals...)
+	if err == nil {
+		storeCacheDataAt(e, generation, emailId, resource, action, map[string]bool{object: allowed})
+	}
+	return allowed, err
+}
+
+// enforceByEmailE is enforceByEmail which returns evaluation errors, raised as panics by casbin, instead of
+// only logging them
+func (e *EnforcerImpl) enforceByEmailE(enf *casbin.Enforcer, rvals ...interface{}) (bool, error) {
 	// check the default role
 	if len(rvals) == 0 {
-		return false
+		return false, nil
 	}
-	defer handlePanic()
-	enforcedStatus := enf.Enforce(rvals...)
-	return enforcedStatus
+	if err := e.checkResourceOf(rvals); err != nil {
+		return false, err
+	}
+	if subject, ok := rvals[0].(string); ok {
+		if allowed, decided := e.principalDecision(subject); decided {
+			return allowed, nil
+		}
+	}
+	return e.enforcePolicy(enf, rvals...)
+}
+
+// warnIfPolicyEmpty logs once when a denial comes from an enforcer with no policies at all, a broken policy
+// store denies everyone which would otherwise look the same as a loaded policy denying the request
+func (e *EnforcerImpl) warnIfPolicyEmpty(enf *casbin.Enforcer) {
+	if atomic.LoadInt32(&e.emptyPolicyWarned) == 1 || len(enf.GetPolicy()) > 0 {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&e.emptyPolicyWarned, 0, 1) {
+		e.logger.Warnw("enforcer has no policies, every request is denied, check the policy store")
+	}
+}
+
+// logSlowEnforcement logs a single enforcement started at start which crossed ENFORCER_SLOW_ENFORCEMENT_THRESHOLD_IN_MS
+func (e *EnforcerImpl) logSlowEnforcement(start time.Time, rvals []interface{}) {
+	elapsed := time.Since(start)
+	if elapsed < time.Duration(e.config.SlowEnforcementThresholdInMs)*time.Millisecond {
+		return
+	}
+	e.logger.Warnw("slow enforce request", "rvals", rvals, "elapsedTime", elapsed.Milliseconds(),
+		"threshold", e.config.SlowEnforcementThresholdInMs)
+}
+
+// enforcePolicy evaluates rvals, whose subject is already resolved, falling back to ENFORCER_DEFAULT_ROLE when the
+// subject itself is denied for lack of a grant. A deny policy matching the subject's request wins over the default
+// role. Evaluations against the live enforcer wait for its initial policy load
+func (e *EnforcerImpl) enforcePolicy(enf *casbin.Enforcer, rvals ...interface{}) (bool, error) {
+	if enf == e.Enforcer {
+		if err := e.waitPolicyLoaded(context.Background()); err != nil {
+			return false, err
+		}
+	}
+	allowed, err := e.enforceActions(enf, rvals...)
+	if !allowed && err == nil {
+		e.warnIfPolicyEmpty(enf)
+	}
+	if allowed || err != nil || e.config.DefaultRole == "" || deniedByPolicy(enf, rvals...) {
+		return allowed, err
+	}
+	defaultRoleRvals := append([]interface{}{e.config.DefaultRole}, rvals[1:]...)
+	return e.enforceActions(enf, defaultRoleRvals...)
+}
+
+// enforceActions evaluates rvals and, when denied for lack of a grant, retries with every action granting the
+// requested one as per SetActionInheritance. A deny policy of the requested action wins over grants of the coarse
+// grained actions encompassing it
+func (e *EnforcerImpl) enforceActions(enf *casbin.Enforcer, rvals ...interface{}) (bool, error) {
+	allowed, err := enf.EnforceSafe(rvals...)
+	if allowed || err != nil || len(rvals) < 3 {
+		return allowed, err
+	}
+	action, ok := rvals[2].(string)
+	if !ok {
+		return false, nil
+	}
+	grantingActions := e.grantingActions(action)
+	if len(grantingActions) == 0 || deniedByPolicy(enf, rvals...) {
+		return false, nil
+	}
+	for _, grantingAction := range grantingActions {
+		actionRvals := append([]interface{}{}, rvals...)
+		actionRvals[2] = grantingAction
+		allowed, err = enf.EnforceSafe(actionRvals...)
+		if allowed || err != nil {
+			return allowed, err
+		}
+	}
+	return false, nil
 }
 
 // MatchKeyByPartFunc is the wrapper of our own customised MatchKeyByPart Func
@@ -313,7 +1961,14 @@ func MatchKeyByPartFunc(args ...interface{}) (interface{}, error) {
 
 // MatchKeyByPart checks whether values in key1 matches all values of key2(values are obtained by splitting key by "/")
 // For example - key1 =  "a/b/c" matches key2 = "a/*/c" but not matches for key2 = "a/*/d"
+// A "\*" in key2 is a literal "*", key2 = "a/\*/c" matches key1 = "a/*/c" only
+// Prefixes are compared on rune boundaries, key2 = "a/café*" matches key1 = "a/caféteria"
 func MatchKeyByPart(key1 string, key2 string) bool {
+	return matchKeyByPartSep(key1, key2, "/")
+}
+
+// matchKeyByPartSep is MatchKeyByPart with values obtained by splitting keys by sep
+func matchKeyByPartSep(key1 string, key2 string, sep string) bool {
 
 	if key2 == "*" {
 		//policy must be for super-admin role or global-env action
@@ -321,8 +1976,8 @@ func MatchKeyByPart(key1 string, key2 string) bool {
 		return true
 	}
 
-	key1Vals := strings.Split(key1, "/")
-	key2Vals := strings.Split(key2, "/")
+	key1Vals := strings.Split(key1, sep)
+	key2Vals := strings.Split(key2, sep)
 
 	if (len(key1Vals) != len(key2Vals)) || len(key1Vals) == 0 {
 		//values in keys should be more than zero and must be equal
@@ -330,29 +1985,51 @@ func MatchKeyByPart(key1 string, key2 string) bool {
 	}
 
 	for i, key2Val := range key2Vals {
-		key1Val := key1Vals[i]
-
-		if key2Val == "" || key1Val == "" {
-			//empty values are not allowed in any key
+		if !matchSegment(key1Vals[i], key2Val) {
 			return false
-		} else {
-			// getting index of "*" in key2, will check values of key1 accordingly
-			//for example - key2Val = a/bc*/d & key1Val = a/bcd/d, in this case "bc" will be checked in key1Val(upto index of "*")
-			j := strings.Index(key2Val, "*")
-			if j == -1 {
-				if key1Val != key2Val {
-					return false
-				}
-			} else if len(key1Val) > j {
-				if key1Val[:j] != key2Val[:j] {
-					return false
-				}
-			} else {
-				if key1Val != key2Val[:j] {
-					return false
-				}
-			}
 		}
 	}
 	return true
 }
+
+// matchSegment matches a single value of key1 against the value of key2 at the same position, as MatchKeyByPart does
+// for each of their values. Unlike MatchKeyByPart(key1Val, "*"), a "*" key2Val doesn't match an empty key1Val
+func matchSegment(key1Val string, key2Val string) bool {
+	if key2Val == "" || key1Val == "" {
+		//empty values are not allowed in any key
+		return false
+	} else if strings.Contains(key2Val, `\`) {
+		// escaped "\*" is a literal "*", only the part of key2Val before the first unescaped "*" is checked
+		prefix, wildcard := unescapeSegment(key2Val)
+		return (wildcard && hasSegmentPrefix(key1Val, prefix)) || (!wildcard && key1Val == prefix)
+	}
+	// only the part of key2Val before its first "*" is checked as a prefix of key1Val, a key1Val shorter than
+	// this part never matches
+	//for example - key2Val = a/bc*/d & key1Val = a/bcd/d, in this case "bc" will be checked in key1Val(upto index of "*")
+	prefix, _, wildcard := strings.Cut(key2Val, "*")
+	return (wildcard && hasSegmentPrefix(key1Val, prefix)) || (!wildcard && key1Val == key2Val)
+}
+
+// hasSegmentPrefix checks whether value starts with prefix, ending on a rune boundary of value so that a prefix cut
+// within a multibyte rune, e.g. of a policy with invalid UTF-8, never matches part of a rune
+func hasSegmentPrefix(value string, prefix string) bool {
+	return strings.HasPrefix(value, prefix) && (len(value) == len(prefix) || utf8.RuneStart(value[len(prefix)]))
+}
+
+// unescapeSegment returns segment up to its first unescaped "*" with "\*" replaced by "*", wildcard tells whether
+// an unescaped "*" was found
+func unescapeSegment(segment string) (prefix string, wildcard bool) {
+	var builder strings.Builder
+	for i := 0; i < len(segment); i++ {
+		switch {
+		case segment[i] == '\\' && i+1 < len(segment) && segment[i+1] == '*':
+			builder.WriteByte('*')
+			i++
+		case segment[i] == '*':
+			return builder.String(), true
+		default:
+			builder.WriteByte(segment[i])
+		}
+	}
+	return builder.String(), false
+}
@@ -0,0 +1,1946 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin"
+	"github.com/devtron-labs/authenticator/client"
+	"github.com/devtron-labs/authenticator/middleware"
+	"github.com/devtron-labs/authenticator/oidc"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testModel = `
+[request_definition]
+r = sub, res, act, obj
+
+[policy_definition]
+p = sub, res, act, obj, eft
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[role_definition]
+g = _, _
+
+[matchers]
+m = g(r.sub, p.sub) && matchKeyByPart(r.res, p.res) && matchKeyByPart(r.act, p.act) && matchKeyByPart(r.obj, p.obj)
+`
+
+// slowMatchModel is testModel with the object matched through slowMatch, letting tests inject matcher latency
+const slowMatchModel = `
+[request_definition]
+r = sub, res, act, obj
+
+[policy_definition]
+p = sub, res, act, obj, eft
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[role_definition]
+g = _, _
+
+[matchers]
+m = g(r.sub, p.sub) && matchKeyByPart(r.res, p.res) && matchKeyByPart(r.act, p.act) && slowMatch(r.obj, p.obj)
+`
+
+type matcherFunc = func(args ...interface{}) (interface{}, error)
+
+// newTestCasbinEnforcer builds an in-memory casbin enforcer on the default model with the given policies
+func newTestCasbinEnforcer(policies [][]string, groupings [][]string) *casbin.Enforcer {
+	return newTestCasbinEnforcerWithModel(testModel, nil, policies, groupings)
+}
+
+func newTestCasbinEnforcerWithModel(modelText string, functions map[string]matcherFunc, policies [][]string, groupings [][]string) *casbin.Enforcer {
+	enf := casbin.NewEnforcer(casbin.NewModel(modelText), false)
+	enf.AddFunction("matchKeyByPart", MatchKeyByPartFunc)
+	for name, function := range functions {
+		enf.AddFunction(name, function)
+	}
+	for _, p := range policies {
+		enf.AddPolicy(p)
+	}
+	for _, g := range groupings {
+		enf.AddGroupingPolicy(g)
+	}
+	return enf
+}
+
+func newTestEnforcer(t *testing.T, cacheEnabled bool, policies [][]string, groupings [][]string) *EnforcerImpl {
+	return newTestEnforcerFor(t, cacheEnabled, newTestCasbinEnforcer(policies, groupings))
+}
+
+func newTestEnforcerFor(t *testing.T, cacheEnabled bool, enf *casbin.Enforcer) *EnforcerImpl {
+	if cacheEnabled {
+		t.Setenv("ENFORCER_CACHE", "true")
+	} else {
+		t.Setenv("ENFORCER_CACHE", "false")
+	}
+	return NewEnforcerImpl(enf, testSessionManager, nopLogger)
+}
+
+var nopLogger = zap.NewNop().Sugar()
+
+// logRecorder collects the entries written through its logger
+type logRecorder struct {
+	mutex   sync.Mutex
+	entries []zapcore.Entry
+}
+
+func newLogRecorder() (*logRecorder, *zap.SugaredLogger) {
+	recorder := &logRecorder{}
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(io.Discard), zapcore.DebugLevel)
+	logger := zap.New(core, zap.Hooks(func(entry zapcore.Entry) error {
+		recorder.mutex.Lock()
+		defer recorder.mutex.Unlock()
+		recorder.entries = append(recorder.entries, entry)
+		return nil
+	}))
+	return recorder, logger.Sugar()
+}
+
+// count returns the number of entries logged with message
+func (r *logRecorder) count(message string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	count := 0
+	for _, entry := range r.entries {
+		if entry.Message == message {
+			count++
+		}
+	}
+	return count
+}
+
+// levelOf returns the level of the last entry logged with message
+func (r *logRecorder) levelOf(message string) (zapcore.Level, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		if r.entries[i].Message == message {
+			return r.entries[i].Level, true
+		}
+	}
+	return zapcore.InfoLevel, false
+}
+
+const testServerSecret = "test-server-secret"
+
+var testSessionManager = middleware.NewSessionManager(&oidc.Settings{OIDCConfig: oidc.OIDCConfig{ServerSecret: testServerSecret}}, &client.DexConfig{}, nil)
+
+// newTestToken signs claims as a locally issued token verifiable by testSessionManager
+func newTestToken(t testing.TB, claims jwt.MapClaims) string {
+	claims["iss"] = middleware.SessionManagerClaimsIssuer
+	if _, ok := claims["iat"]; !ok {
+		claims["iat"] = time.Now().Unix()
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testServerSecret))
+	if err != nil {
+		t.Fatalf("error in signing test token: %v", err)
+	}
+	return token
+}
+
+// slowMatcher is a matchKeyByPart which sleeps for delay before matching
+func slowMatcher(delay time.Duration) matcherFunc {
+	return func(args ...interface{}) (interface{}, error) {
+		time.Sleep(delay)
+		return MatchKeyByPartFunc(args...)
+	}
+}
+
+var testPolicies = [][]string{
+	{"user@example.com", "applications", "get", "team1/*", "allow"},
+	{"user@example.com", "applications", "get", "team2/app1", "allow"},
+	{"role:team3-admin", "applications", "*", "team3/*", "allow"},
+}
+
+var testGroupings = [][]string{
+	{"user@example.com", "role:team3-admin"},
+}
+
+func TestGetAllowedObjectsSorted(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	candidates := []string{"team3/b", "team2/app2", "team1/z", "team2/app1", "team1/a", "team3/b"}
+	got := enforcer.GetAllowedObjectsSorted("user@example.com", "applications", "get", candidates)
+	want := []string{"team1/a", "team1/z", "team2/app1", "team3/b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAllowedObjectsSorted() = %v, want %v", got, want)
+	}
+}
+
+func TestAllowedActions(t *testing.T) {
+	policies := append([][]string{{"user@example.com", "applications", "update", "team1/*", "allow"}}, testPolicies...)
+	enforcer := newTestEnforcer(t, true, policies, testGroupings)
+	actions := []string{"delete", "update", "get", "create", "get"}
+	got, err := enforcer.AllowedActions("user@example.com", "applications", "team1/app1", actions)
+	if want := []string{"update", "get"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("AllowedActions() = %v, %v, want %v", got, err, want)
+	}
+	if !enforcer.IsCached("user@example.com", "applications", "delete", "team1/app1") {
+		t.Errorf("AllowedActions() decisions not cached")
+	}
+	if got, _ := enforcer.AllowedActions("user@example.com", "applications", "team9/app1", actions); len(got) != 0 {
+		t.Errorf("AllowedActions() of an object without grants = %v, want none", got)
+	}
+}
+
+func TestStoreCacheDataConcurrentResources(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	emailId := "user@example.com"
+	resources := []string{"applications", "environment", "cluster", "team"}
+	wg := sync.WaitGroup{}
+	for _, resource := range resources {
+		wg.Add(1)
+		go func(resource string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				storeCacheData(enforcer, emailId, resource, "get", map[string]bool{fmt.Sprintf("obj-%d", i): true})
+			}
+		}(resource)
+	}
+	wg.Wait()
+	for _, resource := range resources {
+		result := getCacheData(enforcer, emailId, resource, "get")
+		if len(result) != 50 {
+			t.Errorf("cache entry for resource %s has %d objects, want 50", resource, len(result))
+		}
+	}
+}
+
+func TestCacheEnabled(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheEnabled bool
+	}{
+		{name: "cache on", cacheEnabled: true},
+		{name: "cache off", cacheEnabled: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enforcer := newTestEnforcer(t, tt.cacheEnabled, testPolicies, testGroupings)
+			if got := enforcer.CacheEnabled(); got != tt.cacheEnabled {
+				t.Errorf("CacheEnabled() = %v, want %v", got, tt.cacheEnabled)
+			}
+		})
+	}
+}
+
+func TestEnforceByEmailInBatchN(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	var vals []string
+	for i := 0; i < 23; i++ {
+		vals = append(vals, fmt.Sprintf("team%d/app%d", i%4, i))
+	}
+	want := enforcer.EnforceByEmailInBatchN("user@example.com", "applications", "get", vals, 1)
+	if len(want) != len(vals) {
+		t.Fatalf("EnforceByEmailInBatchN() returned %d results, want %d", len(want), len(vals))
+	}
+	for _, concurrency := range []int{-1, 0, 2, 3, 5, 7, 23, 1000} {
+		got := enforcer.EnforceByEmailInBatchN("user@example.com", "applications", "get", vals, concurrency)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("EnforceByEmailInBatchN() with concurrency %d = %v, want %v", concurrency, got, want)
+		}
+	}
+}
+
+func TestInvalidateBySubjectPrefix(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	emails := []string{"dev1@team-a.com", "dev2@team-a.com", "dev1@team-b.com"}
+	for _, emailId := range emails {
+		storeCacheData(enforcer, emailId, "applications", "get", map[string]bool{"team1/app": true})
+	}
+	enforcer.InvalidateBySubjectPrefix("dev1@")
+	for _, emailId := range emails {
+		cached := getCacheData(enforcer, emailId, "applications", "get") != nil
+		if want := emailId == "dev2@team-a.com"; cached != want {
+			t.Errorf("cache present for %s = %v, want %v", emailId, cached, want)
+		}
+	}
+}
+
+func TestInvalidateRole(t *testing.T) {
+	policies := [][]string{
+		{"role:dev", "applications", "get", "team1/*", "allow"},
+		{"other@example.com", "applications", "get", "team1/*", "allow"},
+	}
+	groupings := [][]string{
+		{"dev@example.com", "role:dev"},
+		{"lead@example.com", "role:lead"},
+		{"role:lead", "role:dev"},
+	}
+	enforcer := newTestEnforcer(t, true, policies, groupings)
+	emails := []string{"dev@example.com", "lead@example.com", "other@example.com"}
+	for _, emailId := range emails {
+		if enforcer.EnforceByEmail(emailId, "applications", "delete", "team1/app1") {
+			t.Fatalf("EnforceByEmail() of %s allowed delete before the role's policy change", emailId)
+		}
+	}
+
+	enforcer.Enforcer.AddPolicy("role:dev", "applications", "delete", "team1/*", "allow")
+	enforcer.InvalidateRole("Role:Dev")
+	for _, emailId := range emails {
+		cached := enforcer.IsCached(emailId, "applications", "delete", "team1/app1")
+		if want := emailId == "other@example.com"; cached != want {
+			t.Errorf("cache present for %s = %v, want %v", emailId, cached, want)
+		}
+	}
+	for _, emailId := range emails[:2] {
+		if !enforcer.EnforceByEmail(emailId, "applications", "delete", "team1/app1") {
+			t.Errorf("EnforceByEmail() of %s denied after the role's policy change", emailId)
+		}
+	}
+
+	enforcer.InvalidateRole("*")
+	if enforcer.IsCached("other@example.com", "applications", "delete", "team1/app1") {
+		t.Errorf("InvalidateRole(\"*\") kept the cache")
+	}
+
+	embedded, err := NewEnforcerWithEmbeddedModel(nil)
+	if err != nil {
+		t.Fatalf("NewEnforcerWithEmbeddedModel() = %v", err)
+	}
+	embedded.AddPolicy("other@example.com", "applications", "get", "team1/*", "allow")
+	withoutGroupings := newTestEnforcerFor(t, true, embedded)
+	withoutGroupings.EnforceByEmail("other@example.com", "applications", "get", "team1/app1")
+	withoutGroupings.InvalidateRole("role:dev")
+	if withoutGroupings.IsCached("other@example.com", "applications", "get", "team1/app1") {
+		t.Errorf("InvalidateRole() without role links kept the cache")
+	}
+}
+
+func TestEnforceByEmailInBatchWithContextDeadline(t *testing.T) {
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": slowMatcher(10 * time.Millisecond)}, testPolicies, testGroupings)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	var vals []string
+	for i := 0; i < 100; i++ {
+		vals = append(vals, fmt.Sprintf("team1/app%d", i))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result, err := enforcer.EnforceByEmailInBatchWithContext(ctx, "user@example.com", "applications", "get", vals)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("EnforceByEmailInBatchWithContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("EnforceByEmailInBatchWithContext() took %v after deadline", elapsed)
+	}
+	if len(result) == 0 || len(result) >= len(vals) {
+		t.Errorf("EnforceByEmailInBatchWithContext() returned %d results, want partial results", len(result))
+	}
+	for object, allowed := range result {
+		if !allowed {
+			t.Errorf("partial result for %s = false, want true", object)
+		}
+	}
+}
+
+func TestEnforceByEmailInBatchConfiguredTimeout(t *testing.T) {
+	t.Setenv("ENFORCER_BATCH_TIMEOUT_IN_MS", "30")
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": slowMatcher(10 * time.Millisecond)}, testPolicies, testGroupings)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	var vals []string
+	for i := 0; i < 100; i++ {
+		vals = append(vals, fmt.Sprintf("team1/app%d", i))
+	}
+	result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals)
+	if len(result) >= len(vals) {
+		t.Errorf("EnforceByEmailInBatch() returned %d results, want partial results", len(result))
+	}
+}
+
+func TestValidateObjectSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		vals     []string
+		wantErr  bool
+	}{
+		{name: "registered resource valid", resource: ResourceApplications, vals: []string{"team1/app1", "team2/app2"}},
+		{name: "registered resource with prefixed object", resource: ResourceApplications, vals: []string{"team1/app1", "prod/team1/app1"}, wantErr: true},
+		{name: "registered resource all mismatched", resource: ResourceHelmApp, vals: []string{"team1/app1"}, wantErr: true},
+		{name: "unregistered resource consistent", resource: "custom", vals: []string{"a/b/c", "d/e/f"}},
+		{name: "unregistered resource inconsistent", resource: "custom", vals: []string{"a/b/c", "d/e"}, wantErr: true},
+		{name: "empty vals", resource: ResourceApplications, vals: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateObjectSegments(tt.resource, tt.vals); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateObjectSegments() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnforceByEmailInBatchWithContextMismatchedSegments(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	_, err := enforcer.EnforceByEmailInBatchWithContext(context.Background(), "user@example.com", ResourceApplications, "get", []string{"team1/app1", "prod/team1/app1"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("EnforceByEmailInBatchWithContext() error = %v, want code %v", err, codes.InvalidArgument)
+	}
+	if getCacheData(enforcer, "user@example.com", ResourceApplications, "get") != nil {
+		t.Errorf("EnforceByEmailInBatchWithContext() cached results for invalid input")
+	}
+}
+
+func TestGetAllSubjectsAndRoles(t *testing.T) {
+	var enforcer Enforcer = newTestEnforcer(t, false, testPolicies, testGroupings)
+	subjects := enforcer.GetAllSubjects()
+	sort.Strings(subjects)
+	if want := []string{"role:team3-admin", "user@example.com"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("GetAllSubjects() = %v, want %v", subjects, want)
+	}
+	if roles, want := enforcer.GetAllRoles(), []string{"role:team3-admin"}; !reflect.DeepEqual(roles, want) {
+		t.Errorf("GetAllRoles() = %v, want %v", roles, want)
+	}
+}
+
+func TestCacheDecisionStates(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	emailId := "user@example.com"
+	if decision := getCachedDecision(enforcer, emailId, "applications", "get", "team1/app1"); decision != decisionUnknown {
+		t.Errorf("decision without a cache entry = %v, want unknown", decision)
+	}
+	enforcer.EnforceByEmailInBatch(emailId, "applications", "get", []string{"team1/app1", "team4/app1"})
+	tests := []struct {
+		object      string
+		want        cacheDecision
+		wantAllowed bool
+		wantFound   bool
+	}{
+		{object: "team1/app1", want: decisionAllow, wantAllowed: true, wantFound: true},
+		{object: "team4/app1", want: decisionDeny, wantAllowed: false, wantFound: true},
+		{object: "team2/app1", want: decisionUnknown, wantAllowed: false, wantFound: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.object, func(t *testing.T) {
+			if decision := getCachedDecision(enforcer, emailId, "applications", "get", tt.object); decision != tt.want {
+				t.Errorf("getCachedDecision() = %v, want %v", decision, tt.want)
+			}
+			if allowed, found := getCachedObject(enforcer, emailId, "applications", "get", tt.object); allowed != tt.wantAllowed || found != tt.wantFound {
+				t.Errorf("getCachedObject() = %v, %v, want %v, %v", allowed, found, tt.wantAllowed, tt.wantFound)
+			}
+		})
+	}
+	// the unknown object is evaluated rather than taken for a cached deny
+	if allAllowed, firstDenied := enforcer.EnforceByEmailUntilDeny(emailId, "applications", "get", []string{"team2/app1", "team1/app1"}); !allAllowed {
+		t.Errorf("EnforceByEmailUntilDeny() denied %s, want the uncached object evaluated", firstDenied)
+	}
+}
+
+func TestCacheTimeout(t *testing.T) {
+	t.Setenv("ENFORCER_CACHE_TIMEOUT_IN_MS", "20")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	emailId := "user@example.com"
+	// a cache operation stuck on the email's entry
+	slowOperation := getEnforcerCacheLock(enforcer, emailId)
+	slowOperation.Lock()
+
+	start := time.Now()
+	allowed := enforcer.EnforceByEmail(emailId, "applications", "get", "team1/app1")
+	result := enforcer.EnforceByEmailInBatch(emailId, "applications", "get", []string{"team2/app1", "team4/app1"})
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("enforcement behind a slow cache took %v", elapsed)
+	}
+	if !allowed || !reflect.DeepEqual(result, map[string]bool{"team2/app1": true, "team4/app1": false}) {
+		t.Errorf("enforcement behind a slow cache = %v, %v, want evaluated decisions", allowed, result)
+	}
+	if timeouts := enforcer.Stats().CacheTimeouts; timeouts < 2 {
+		t.Errorf("Stats().CacheTimeouts = %d, want at least 2", timeouts)
+	}
+
+	clearCacheLock(enforcer, emailId, slowOperation)
+	enforcer.EnforceByEmail(emailId, "applications", "get", "team1/app1")
+	if !enforcer.IsCached(emailId, "applications", "get", "team1/app1") {
+		t.Errorf("decision not cached once the cache is responsive again")
+	}
+	shard := enforcer.shardOf(emailId)
+	shard.lockMapMutex.Lock()
+	defer shard.lockMapMutex.Unlock()
+	if len(shard.lock) != 0 {
+		t.Errorf("cache locks left after timeouts: %d", len(shard.lock))
+	}
+}
+
+func TestCaseInsensitiveKeys(t *testing.T) {
+	emailId := "user@example.com"
+	cachedKeys := func(enforcer *EnforcerImpl) []string {
+		emailResult, _ := enforcer.Cache.Get(emailId)
+		var keys []string
+		for key := range emailResult.(emailCacheEntry).results {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	enforcer.EnforceByEmailInBatch(emailId, "applications", "get", []string{"team1/app1"})
+	enforcer.EnforceByEmailInBatch(emailId, "Applications", "GET", []string{"team1/app1"})
+	if keys := cachedKeys(enforcer); len(keys) != 2 {
+		t.Errorf("cache keys without normalization = %q, want separate entries", keys)
+	}
+
+	t.Setenv("ENFORCER_CASE_INSENSITIVE_KEYS", "true")
+	enforcer = newTestEnforcer(t, true, testPolicies, testGroupings)
+	if result := enforcer.EnforceByEmailInBatch(emailId, "Applications", "GET", []string{"team1/app1", "team4/app1"}); !result["team1/app1"] || result["team4/app1"] {
+		t.Errorf("EnforceByEmailInBatch() of upper case keys = %v, want team1/app1 allowed", result)
+	}
+	enforcer.EnforceByEmailInBatch(emailId, "applications", "get", []string{"team1/app1"})
+	if !enforcer.EnforceByEmail(emailId, "APPLICATIONS", "Get", "team2/app1") {
+		t.Errorf("EnforceByEmail() of upper case keys denied")
+	}
+	if allAllowed, firstDenied := enforcer.EnforceByEmailUntilDeny(emailId, "Applications", "GET", []string{"team1/app5", "team3/app1"}); !allAllowed {
+		t.Errorf("EnforceByEmailUntilDeny() of upper case keys denied %s", firstDenied)
+	}
+	if keys := cachedKeys(enforcer); !reflect.DeepEqual(keys, []string{getCacheKey("", "applications", "get")}) {
+		t.Errorf("cache keys with normalization = %q, want a single shared entry", keys)
+	}
+	if !enforcer.IsCached(emailId, "Applications", "GET", "team2/app1") {
+		t.Errorf("IsCached() of upper case keys = false, want the shared entry")
+	}
+}
+
+func TestIsCached(t *testing.T) {
+	t.Setenv("ENFORCER_CACHE_SLIDING_EXPIRATION", "true")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	emailId := "user@example.com"
+	if enforcer.IsCached(emailId, "applications", "get", "team1/app1") {
+		t.Errorf("IsCached() before any enforcement = true")
+	}
+	enforcer.EnforceByEmailInBatch(emailId, "applications", "get", []string{"team1/app1", "team4/app1"})
+	_, expiration, _ := enforcer.Cache.GetWithExpiration(emailId)
+	time.Sleep(2 * time.Millisecond)
+	tests := []struct {
+		action string
+		object string
+		want   bool
+	}{
+		{action: "get", object: "team1/app1", want: true},
+		{action: "get", object: "team4/app1", want: true},
+		{action: "get", object: "team2/app1", want: false},
+		{action: "delete", object: "team1/app1", want: false},
+	}
+	for _, tt := range tests {
+		if got := enforcer.IsCached(emailId, "applications", tt.action, tt.object); got != tt.want {
+			t.Errorf("IsCached(%s, %s) = %v, want %v", tt.action, tt.object, got, tt.want)
+		}
+	}
+	if _, afterExpiration, _ := enforcer.Cache.GetWithExpiration(emailId); !afterExpiration.Equal(expiration) {
+		t.Errorf("IsCached() moved the expiration from %v to %v", expiration, afterExpiration)
+	}
+	if enforcer.IsCached(emailId, "applications", "get", "team2/app1") {
+		t.Errorf("IsCached() evaluated the object it was asked about")
+	}
+	if newTestEnforcer(t, false, testPolicies, testGroupings).IsCached(emailId, "applications", "get", "team1/app1") {
+		t.Errorf("IsCached() with cache disabled = true")
+	}
+}
+
+func TestCachedEntryNotMutatedByBatch(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	emailId := "user@example.com"
+	storeCacheData(enforcer, emailId, "applications", "get", map[string]bool{"team1/app1": true})
+	emailResult, _ := enforcer.Cache.Get(emailId)
+	cachedEntry := emailResult.(emailCacheEntry).results[getCacheKey("", "applications", "get")]
+
+	returned := getCacheData(enforcer, emailId, "applications", "get")
+	returned["team9/app9"] = true
+
+	var vals []string
+	for i := 0; i < 20; i++ {
+		vals = append(vals, fmt.Sprintf("team%d/app%d", i%4, i))
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			enforcer.EnforceByEmailInBatchN(emailId, "applications", "get", vals, 4)
+		}()
+	}
+	wg.Wait()
+	if want := map[string]cacheDecision{"team1/app1": decisionAllow}; !reflect.DeepEqual(cachedEntry, want) {
+		t.Errorf("cached entry mutated to %v, want %v", cachedEntry, want)
+	}
+	if result := getCacheData(enforcer, emailId, "applications", "get"); len(result) != len(vals) || result["team9/app9"] {
+		t.Errorf("cache entry after batches = %v, want batch results stored back", result)
+	}
+}
+
+func TestEnforceByEmailInBatchMissingInput(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	tests := []struct {
+		name     string
+		emailId  string
+		resource string
+		action   string
+	}{
+		{name: "empty email", emailId: "", resource: "applications", action: "get"},
+		{name: "empty resource", emailId: "user@example.com", resource: "", action: "get"},
+		{name: "empty action", emailId: "user@example.com", resource: "applications", action: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := enforcer.EnforceByEmailInBatch(tt.emailId, tt.resource, tt.action, []string{"team1/app1"}); len(result) != 0 {
+				t.Errorf("EnforceByEmailInBatch() = %v, want empty result", result)
+			}
+			_, err := enforcer.EnforceByEmailInBatchWithContext(context.Background(), tt.emailId, tt.resource, tt.action, []string{"team1/app1"})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("EnforceByEmailInBatchWithContext() error = %v, want code %v", err, codes.InvalidArgument)
+			}
+			if enforcer.Cache.ItemCount() != 0 {
+				t.Errorf("results cached for invalid input: %v", enforcer.Cache.Items())
+			}
+		})
+	}
+}
+
+func TestCacheNamespaceIsolation(t *testing.T) {
+	t.Setenv("ENFORCER_CACHE_NAMESPACE", "allowing")
+	allowing := newTestEnforcer(t, true, testPolicies, testGroupings)
+	t.Setenv("ENFORCER_CACHE_NAMESPACE", "denying")
+	denying := newTestEnforcer(t, true, nil, nil)
+	denying.Cache = allowing.Cache
+
+	emailId := "user@example.com"
+	if result := allowing.EnforceByEmailInBatch(emailId, "applications", "get", []string{"team1/app1"}); !result["team1/app1"] {
+		t.Fatalf("EnforceByEmailInBatch() on allowing enforcer = false, want true")
+	}
+	if result := denying.EnforceByEmailInBatch(emailId, "applications", "get", []string{"team1/app1"}); result["team1/app1"] {
+		t.Errorf("EnforceByEmailInBatch() on denying enforcer = true, served from other namespace")
+	}
+	if result := allowing.EnforceByEmailInBatch(emailId, "applications", "get", []string{"team1/app1"}); !result["team1/app1"] {
+		t.Errorf("EnforceByEmailInBatch() on allowing enforcer = false after denying enforcer stored its result")
+	}
+}
+
+// failingMatcher is a matchKeyByPart which fails for objects containing "broken"
+func failingMatcher(args ...interface{}) (interface{}, error) {
+	if strings.Contains(args[0].(string), "broken") {
+		return false, errors.New("matcher failure")
+	}
+	return MatchKeyByPartFunc(args...)
+}
+
+func TestEnforceByEmailInBatchDetailed(t *testing.T) {
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": failingMatcher}, testPolicies, testGroupings)
+	enforcer := newTestEnforcerFor(t, true, enf)
+	got := enforcer.EnforceByEmailInBatchDetailed("user@example.com", "applications", "get", []string{"team1/app1", "team1/broken", "team9/app1"})
+	if len(got) != 3 {
+		t.Fatalf("EnforceByEmailInBatchDetailed() returned %d decisions, want 3", len(got))
+	}
+	if decision := got["team1/app1"]; !decision.Allowed || decision.Err != nil {
+		t.Errorf("decision for team1/app1 = %+v, want allowed", decision)
+	}
+	if decision := got["team9/app1"]; decision.Allowed || decision.Err != nil {
+		t.Errorf("decision for team9/app1 = %+v, want denied without error", decision)
+	}
+	if decision := got["team1/broken"]; decision.Allowed || decision.Err == nil {
+		t.Errorf("decision for team1/broken = %+v, want error", decision)
+	}
+	cached := getCacheData(enforcer, "user@example.com", "applications", "get")
+	if _, found := cached["team1/broken"]; found || len(cached) != 2 {
+		t.Errorf("cached results = %v, want only successfully evaluated objects", cached)
+	}
+}
+
+func TestEnforceByEmailInBatchProfiled(t *testing.T) {
+	delay := 5 * time.Millisecond
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": slowMatcher(delay)}, testPolicies, testGroupings)
+	enforcer := newTestEnforcerFor(t, true, enf)
+	vals := []string{"team1/app1", "team2/app1", "team9/app1"}
+	start := time.Now()
+	got := enforcer.EnforceByEmailInBatchProfiled("user@example.com", "applications", "get", vals)
+	elapsed := time.Since(start)
+	if len(got) != len(vals) {
+		t.Fatalf("EnforceByEmailInBatchProfiled() returned %d decisions, want %d", len(got), len(vals))
+	}
+	var total time.Duration
+	for _, object := range vals {
+		decision := got[object]
+		if want := object != "team9/app1"; decision.Allowed != want || decision.Err != nil {
+			t.Errorf("decision for %s = %+v, want allowed %v", object, decision, want)
+		}
+		if decision.Duration < delay {
+			t.Errorf("duration of %s = %v, want at least the matcher delay %v", object, decision.Duration, delay)
+		}
+		total += decision.Duration
+	}
+	if total > elapsed {
+		t.Errorf("sum of durations %v exceeds the batch's %v", total, elapsed)
+	}
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); cached != nil {
+		t.Errorf("cached results = %v, want none", cached)
+	}
+	if decision := enforcer.EnforceByEmailInBatchDetailed("user@example.com", "applications", "get", vals)["team1/app1"]; decision.Duration != 0 {
+		t.Errorf("EnforceByEmailInBatchDetailed() duration = %v, want none recorded", decision.Duration)
+	}
+}
+
+func TestEnforceByEmailE(t *testing.T) {
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": failingMatcher}, testPolicies, testGroupings)
+	enforcer := newTestEnforcerFor(t, true, enf)
+	tests := []struct {
+		name        string
+		emailId     string
+		object      string
+		wantAllowed bool
+		wantCode    codes.Code
+	}{
+		{name: "allowed", emailId: "user@example.com", object: "team1/app1", wantAllowed: true, wantCode: codes.OK},
+		{name: "denied", emailId: "user@example.com", object: "team9/app1", wantCode: codes.OK},
+		{name: "no email", emailId: "", object: "team1/app1", wantCode: codes.Unauthenticated},
+		{name: "evaluation failure", emailId: "user@example.com", object: "team1/broken", wantCode: codes.Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, err := enforcer.EnforceByEmailE(tt.emailId, "applications", "get", tt.object)
+			if allowed != tt.wantAllowed || status.Code(err) != tt.wantCode {
+				t.Errorf("EnforceByEmailE() = %v, %v, want %v, code %v", allowed, err, tt.wantAllowed, tt.wantCode)
+			}
+		})
+	}
+	if allowed, err := enforcer.EnforceByEmailE(); allowed || status.Code(err) != codes.Unauthenticated {
+		t.Errorf("EnforceByEmailE() without arguments = %v, %v, want unauthenticated", allowed, err)
+	}
+}
+
+func TestEnforceByEmailInBatchE(t *testing.T) {
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": failingMatcher}, testPolicies, testGroupings)
+	enforcer := newTestEnforcerFor(t, true, enf)
+	result, err := enforcer.EnforceByEmailInBatchE("user@example.com", "applications", "get", []string{"team1/app1", "team9/app1"})
+	if err != nil || !reflect.DeepEqual(result, map[string]bool{"team1/app1": true, "team9/app1": false}) {
+		t.Errorf("EnforceByEmailInBatchE() = %v, %v, want team1/app1 allowed and team9/app1 denied", result, err)
+	}
+
+	result, err = enforcer.EnforceByEmailInBatchE("user@example.com", "applications", "get", []string{"team1/app2", "team1/broken"})
+	if err == nil || status.Code(err) == codes.PermissionDenied {
+		t.Errorf("EnforceByEmailInBatchE() error = %v, want the evaluation failure", err)
+	}
+	if _, found := result["team1/broken"]; found || !result["team1/app2"] {
+		t.Errorf("EnforceByEmailInBatchE() = %v, want the result of team1/app2 only", result)
+	}
+
+	if result, err := enforcer.EnforceByEmailInBatchE("", "applications", "get", []string{"team1/app1"}); len(result) != 0 || status.Code(err) != codes.Unauthenticated {
+		t.Errorf("EnforceByEmailInBatchE() without email = %v, %v, want unauthenticated", result, err)
+	}
+	if _, err := enforcer.EnforceByEmailInBatchE("user@example.com", "", "get", []string{"team1/app1"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("EnforceByEmailInBatchE() without resource = %v, want invalid argument", err)
+	}
+}
+
+// flakyMatcher is a matchKeyByPart which fails the first time each object is matched
+type flakyMatcher struct {
+	mutex  sync.Mutex
+	failed map[string]bool
+}
+
+func (m *flakyMatcher) match(args ...interface{}) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if object := args[0].(string); !m.failed[object] {
+		m.failed[object] = true
+		return false, errors.New("policies are being reloaded")
+	}
+	return MatchKeyByPartFunc(args...)
+}
+
+func TestEnforceByEmailInBatchRetry(t *testing.T) {
+	vals := []string{"team1/app1", "team2/app1"}
+	policies := [][]string{{"user@example.com", "applications", "get", "team1/*", "allow"}}
+	newEnforcer := func(retries string) *EnforcerImpl {
+		t.Setenv("ENFORCER_BATCH_RETRY_COUNT", retries)
+		t.Setenv("ENFORCER_BATCH_RETRY_BACKOFF_IN_MS", "1")
+		matcher := &flakyMatcher{failed: make(map[string]bool)}
+		enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": matcher.match}, policies, nil)
+		return newTestEnforcerFor(t, false, enf)
+	}
+
+	got := newEnforcer("2").EnforceByEmailInBatchDetailed("user@example.com", "applications", "get", vals)
+	if decision := got["team1/app1"]; !decision.Allowed || decision.Err != nil {
+		t.Errorf("decision for team1/app1 with retries = %+v, want allowed", decision)
+	}
+	if decision := got["team2/app1"]; decision.Allowed || decision.Err != nil {
+		t.Errorf("decision for team2/app1 with retries = %+v, want denied without error", decision)
+	}
+
+	got = newEnforcer("0").EnforceByEmailInBatchDetailed("user@example.com", "applications", "get", vals)
+	for _, object := range vals {
+		if decision := got[object]; decision.Allowed || decision.Err == nil {
+			t.Errorf("decision for %s without retries = %+v, want error", object, decision)
+		}
+	}
+}
+
+func TestIsRetryableEnforceErr(t *testing.T) {
+	if !isRetryableEnforceErr(errors.New("matcher failure")) {
+		t.Error("isRetryableEnforceErr() = false for an evaluation failure, want true")
+	}
+	if isRetryableEnforceErr(status.Error(codes.InvalidArgument, "unknown resource")) {
+		t.Error("isRetryableEnforceErr() = true for an invalid request, want false")
+	}
+}
+
+func TestDefaultRole(t *testing.T) {
+	policies := append([][]string{{"role:baseline", "applications", "get", "public/*", "allow"}}, testPolicies...)
+	t.Setenv("ENFORCER_DEFAULT_ROLE", "role:baseline")
+	enforcer := newTestEnforcer(t, false, policies, testGroupings)
+	if !enforcer.EnforceByEmail("nopolicy@example.com", "applications", "get", "public/app1") {
+		t.Errorf("EnforceByEmail() for subject without policy = false, want default role grant")
+	}
+	if enforcer.EnforceByEmail("nopolicy@example.com", "applications", "get", "team1/app1") {
+		t.Errorf("EnforceByEmail() outside default role = true, want false")
+	}
+	token := newTestToken(t, jwt.MapClaims{"email": "nopolicy@example.com"})
+	if !enforcer.Enforce(token, "applications", "get", "public/app1") {
+		t.Errorf("Enforce() for subject without policy = false, want default role grant")
+	}
+	if !enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1") {
+		t.Errorf("EnforceByEmail() with own policy = false, want true")
+	}
+	enforcer.AddDenyPolicy("nopolicy@example.com", "applications", "get", "public/app1")
+	if enforcer.EnforceByEmail("nopolicy@example.com", "applications", "get", "public/app1") {
+		t.Errorf("EnforceByEmail() of an explicitly denied object = true, want the deny to win over the default role")
+	}
+	if result := enforcer.EnforceByEmailInBatch("nopolicy@example.com", "applications", "get", []string{"public/app1", "public/app2"}); result["public/app1"] || !result["public/app2"] {
+		t.Errorf("EnforceByEmailInBatch() = %v, want only the explicitly denied object denied", result)
+	}
+
+	t.Setenv("ENFORCER_DEFAULT_ROLE", "")
+	enforcer = newTestEnforcer(t, false, policies, testGroupings)
+	if enforcer.EnforceByEmail("nopolicy@example.com", "applications", "get", "public/app1") {
+		t.Errorf("EnforceByEmail() without default role configured = true, want false")
+	}
+}
+
+func TestEnforceAnySubject(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	tests := []struct {
+		name     string
+		subjects []string
+		object   string
+		want     bool
+	}{
+		{name: "only one subject granted", subjects: []string{"svc-a@example.com", "User@example.com", "svc-b@example.com"}, object: "team1/app1", want: true},
+		{name: "no subject granted", subjects: []string{"svc-a@example.com", "user@example.com"}, object: "team9/app1", want: false},
+		{name: "no subjects", subjects: nil, object: "team1/app1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := enforcer.EnforceAnySubject(tt.subjects, "applications", "get", tt.object); got != tt.want {
+				t.Errorf("EnforceAnySubject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnforceByEmailInBatchSyncThreshold(t *testing.T) {
+	vals := []string{"team1/app1", "team9/app1", "team3/app1"}
+	want := map[string]bool{"team1/app1": true, "team9/app1": false, "team3/app1": true}
+	for _, threshold := range []string{"0", "1", "3", "10"} {
+		t.Setenv("ENFORCER_BATCH_SYNC_THRESHOLD", threshold)
+		enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+		if got := enforcer.EnforceByEmailInBatchN("user@example.com", "applications", "get", vals, 2); !reflect.DeepEqual(got, want) {
+			t.Errorf("EnforceByEmailInBatchN() with threshold %s = %v, want %v", threshold, got, want)
+		}
+		if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); !reflect.DeepEqual(cached, want) {
+			t.Errorf("cached results with threshold %s = %v, want %v", threshold, cached, want)
+		}
+	}
+}
+
+func TestEnforceByEmailInBatchSync(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	wg := &sync.WaitGroup{}
+	mutex := &sync.RWMutex{}
+	result := make(map[string]bool)
+	metrics := make(map[int]int64)
+	wg.Add(1)
+	go EnforceByEmailInBatchSync(enforcer, wg, mutex, result, metrics, 0, "User@Example.com", "applications", "get", []string{"team1/app1", "team9/app1"})
+	wg.Wait()
+	if want := map[string]bool{"team1/app1": true, "team9/app1": false}; !reflect.DeepEqual(result, want) {
+		t.Errorf("EnforceByEmailInBatchSync() results = %v, want %v", result, want)
+	}
+	if _, found := metrics[0]; !found {
+		t.Errorf("EnforceByEmailInBatchSync() recorded no duration for batch 0")
+	}
+}
+
+func TestEnforceByEmailInBatchDeterministic(t *testing.T) {
+	t.Setenv("ENFORCER_BATCH_SYNC_THRESHOLD", "0")
+	policies := append([][]string{
+		{"user@example.com", "applications", "get", "team5/secret", "deny"},
+		{"user@example.com", "applications", "get", "team5/*", "allow"},
+	}, testPolicies...)
+	random := rand.New(rand.NewSource(431))
+	for round := 0; round < 10; round++ {
+		// duplicates, empty objects and sizes not divisible by the batch sizes
+		vals := make([]string, random.Intn(300))
+		for i := range vals {
+			switch random.Intn(10) {
+			case 0:
+				vals[i] = ""
+			case 1:
+				vals[i] = "team5/secret"
+			default:
+				vals[i] = fmt.Sprintf("team%d/app%d", random.Intn(6), random.Intn(50))
+			}
+		}
+		var want map[string]bool
+		for _, batchSize := range []int{1, 4, 64} {
+			for _, cacheEnabled := range []bool{false, true} {
+				enforcer := newTestEnforcer(t, cacheEnabled, policies, testGroupings)
+				got := enforcer.EnforceByEmailInBatchN("user@example.com", "applications", "get", vals, batchSize)
+				if want == nil {
+					want = got
+					for _, object := range vals {
+						if _, found := want[object]; !found && object != "" {
+							t.Fatalf("round %d: object %q missing from results", round, object)
+						}
+					}
+					continue
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("round %d: results with batch size %d and cache %v = %v, want %v", round, batchSize, cacheEnabled, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestEnforceByEmailInBatchInto(t *testing.T) {
+	for _, cacheEnabled := range []bool{false, true} {
+		enforcer := newTestEnforcer(t, cacheEnabled, testPolicies, testGroupings)
+		enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/other")
+		dst := map[string]bool{"stale": true, "team4/app1": true}
+		vals := []string{"team1/app1", "team4/app1", "team3/app1"}
+		enforcer.EnforceByEmailInBatchInto(dst, "user@example.com", "applications", "get", vals)
+		want := map[string]bool{"team1/app1": true, "team4/app1": false, "team3/app1": true}
+		if !reflect.DeepEqual(dst, want) {
+			t.Errorf("dst with cache %v = %v, want %v", cacheEnabled, dst, want)
+		}
+		// served from the cache the second time
+		enforcer.EnforceByEmailInBatchInto(dst, "user@example.com", "applications", "get", vals[:2])
+		if want := map[string]bool{"team1/app1": true, "team4/app1": false}; !reflect.DeepEqual(dst, want) {
+			t.Errorf("reused dst with cache %v = %v, want %v", cacheEnabled, dst, want)
+		}
+		enforcer.EnforceByEmailInBatchInto(dst, "", "applications", "get", vals)
+		if len(dst) != 0 {
+			t.Errorf("dst of a rejected batch = %v, want it cleared", dst)
+		}
+	}
+}
+
+func BenchmarkEnforceByEmailInBatchInto(b *testing.B) {
+	b.Setenv("ENFORCER_CACHE", "true")
+	enforcer := NewEnforcerImpl(newTestCasbinEnforcer(testPolicies, testGroupings), testSessionManager, nopLogger)
+	vals := make([]string, 100)
+	for i := range vals {
+		vals[i] = fmt.Sprintf("team%d/app%d", i%4, i)
+	}
+	enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals)
+	b.Run("new map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals)
+		}
+	})
+	b.Run("reused map", func(b *testing.B) {
+		dst := make(map[string]bool, len(vals))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			enforcer.EnforceByEmailInBatchInto(dst, "user@example.com", "applications", "get", vals)
+		}
+	})
+}
+
+func BenchmarkEnforceByEmailInBatchSingle(b *testing.B) {
+	for _, threshold := range []string{"0", "1"} {
+		b.Run("threshold-"+threshold, func(b *testing.B) {
+			b.Setenv("ENFORCER_BATCH_SYNC_THRESHOLD", threshold)
+			b.Setenv("ENFORCER_CACHE", "false")
+			enforcer := NewEnforcerImpl(newTestCasbinEnforcer(testPolicies, testGroupings), testSessionManager, nopLogger)
+			vals := []string{"team1/app1"}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals)
+			}
+		})
+	}
+}
+
+// countingMatcher is a matchKeyByPart, sleeping for delay, which counts its invocations per requested object
+type countingMatcher struct {
+	mutex sync.Mutex
+	delay time.Duration
+	calls map[string]int
+}
+
+func newCountingMatcher(delay time.Duration) *countingMatcher {
+	return &countingMatcher{delay: delay, calls: make(map[string]int)}
+}
+
+func (m *countingMatcher) match(args ...interface{}) (interface{}, error) {
+	m.mutex.Lock()
+	m.calls[args[0].(string)]++
+	m.mutex.Unlock()
+	time.Sleep(m.delay)
+	return MatchKeyByPartFunc(args...)
+}
+
+func (m *countingMatcher) callsFor(object string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.calls[object]
+}
+
+func TestEnforceByEmailInBatchSingleFlight(t *testing.T) {
+	t.Setenv("ENFORCER_BATCH_SINGLE_FLIGHT", "true")
+	matcher := newCountingMatcher(50 * time.Millisecond)
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": matcher.match},
+		[][]string{{"user@example.com", "applications", "get", "team1/*", "allow"}}, nil)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	vals := []string{"team1/app1", "team1/app2", "team2/app1", "team1/app3"}
+	want := map[string]bool{"team1/app1": true, "team1/app2": true, "team2/app1": false, "team1/app3": true}
+
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+	results := make([]map[string]bool, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			results[i] = enforcer.EnforceByEmailInBatchN("user@example.com", "applications", "get", vals, 4)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	for i, result := range results {
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("result of request %d = %v, want %v", i, result, want)
+		}
+	}
+	for _, item := range vals {
+		if calls := matcher.callsFor(item); calls != 1 {
+			t.Errorf("object %s evaluated %d times, want 1", item, calls)
+		}
+	}
+}
+
+func TestEnforceByEmailInBatchOverlappingSingleFlight(t *testing.T) {
+	t.Setenv("ENFORCER_BATCH_SINGLE_FLIGHT", "true")
+	t.Setenv("ENFORCER_BATCH_SYNC_THRESHOLD", "10")
+	matcher := newCountingMatcher(20 * time.Millisecond)
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": matcher.match},
+		[][]string{{"user@example.com", "applications", "get", "team1/*", "allow"}}, nil)
+	enforcer := newTestEnforcerFor(t, true, enf)
+	batches := [][]string{
+		{"team1/app1", "team1/app2", "team2/app1", "team1/app3"},
+		{"team1/app3", "team2/app1", "team1/app2", "team1/app4"},
+		{"team1/app4", "team1/app2"},
+	}
+	want := map[string]bool{"team1/app1": true, "team1/app2": true, "team2/app1": false, "team1/app3": true, "team1/app4": true}
+
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+	results := make([]map[string]bool, len(batches))
+	for i := range batches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			results[i] = enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", batches[i])
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	for i, vals := range batches {
+		for _, item := range vals {
+			if results[i][item] != want[item] {
+				t.Errorf("batch %d result for %s = %v, want %v", i, item, results[i][item], want[item])
+			}
+		}
+	}
+	for item := range want {
+		if calls := matcher.callsFor(item); calls != 1 {
+			t.Errorf("object %s evaluated %d times across overlapping batches, want 1", item, calls)
+		}
+	}
+	if flights := len(enforcer.objectFlights.flights); flights != 0 {
+		t.Errorf("%d object flights left after the batches, want none", flights)
+	}
+}
+
+func TestEnforceByEmailInBatchWildcardGrant(t *testing.T) {
+	const fastPath = "allowing batch through wildcard action and object grant"
+	vals := []string{"team1/app1", "team2/app1", "team3/app1"}
+	tests := []struct {
+		name         string
+		policies     [][]string
+		want         map[string]bool
+		wantFastPath bool
+	}{
+		{
+			name:         "wildcard action and object grant",
+			policies:     [][]string{{"role:apps-admin", "applications", "*", "*", "allow"}},
+			want:         map[string]bool{"team1/app1": true, "team2/app1": true, "team3/app1": true},
+			wantFastPath: true,
+		},
+		{
+			name: "wildcard grant narrowed by a deny",
+			policies: [][]string{
+				{"role:apps-admin", "applications", "*", "*", "allow"},
+				{"user@example.com", "applications", "get", "team2/*", "deny"},
+			},
+			want: map[string]bool{"team1/app1": true, "team2/app1": false, "team3/app1": true},
+		},
+		{
+			name:     "wildcard action on some objects",
+			policies: [][]string{{"role:apps-admin", "applications", "*", "team1/*", "allow"}},
+			want:     map[string]bool{"team1/app1": true, "team2/app1": false, "team3/app1": false},
+		},
+		{
+			name:     "wildcard action on the literal * object",
+			policies: [][]string{{"role:apps-admin", "applications", "*", `\*`, "allow"}},
+			want:     map[string]bool{"team1/app1": false, "team2/app1": false, "team3/app1": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enf, err := NewEnforcerWithEmbeddedModel(nil)
+			if err != nil {
+				t.Fatalf("NewEnforcerWithEmbeddedModel() = %v", err)
+			}
+			for _, policy := range tt.policies {
+				enf.AddPolicy(policy)
+			}
+			enf.AddGroupingPolicy("user@example.com", "role:apps-admin")
+			enforcer := newTestEnforcerFor(t, false, enf)
+			recorder, logger := newLogRecorder()
+			enforcer.logger = logger
+			if got := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EnforceByEmailInBatch() = %v, want %v", got, tt.want)
+			}
+			if took := recorder.count(fastPath) == 1; took != tt.wantFastPath {
+				t.Errorf("batch through the wildcard grant = %v, want %v", took, tt.wantFastPath)
+			}
+			for _, item := range vals {
+				if single := enforcer.EnforceByEmail("user@example.com", "applications", "get", item); single != tt.want[item] {
+					t.Errorf("EnforceByEmail(%s) = %v, disagrees with the batch", item, single)
+				}
+			}
+		})
+	}
+
+	// the matcher of a custom model may deny what a wildcard grant of the default model allows
+	deny := func(args ...interface{}) (interface{}, error) {
+		return false, nil
+	}
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": deny},
+		[][]string{{"user@example.com", "applications", "*", "*", "allow"}}, nil)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	if got := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals); len(got) != len(vals) || got["team1/app1"] {
+		t.Errorf("EnforceByEmailInBatch() of a custom model denying every object = %v, want all denied", got)
+	}
+}
+
+func TestCachedEmails(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	storeCacheData(enforcer, "user@example.com", "applications", "get", map[string]bool{"team1/app1": true})
+	storeCacheData(enforcer, "other@example.com", "applications", "get", map[string]bool{"team1/app1": false})
+	expirations := make(map[string]int64)
+	for emailId, item := range enforcer.Cache.Items() {
+		expirations[emailId] = item.Expiration
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	emailIds := enforcer.CachedEmails()
+	if want := []string{"other@example.com", "user@example.com"}; !reflect.DeepEqual(emailIds, want) {
+		t.Fatalf("CachedEmails() = %v, want %v", emailIds, want)
+	}
+	for emailId, item := range enforcer.Cache.Items() {
+		if item.Expiration != expirations[emailId] {
+			t.Errorf("expiration of %s changed from %d to %d", emailId, expirations[emailId], item.Expiration)
+		}
+	}
+	if emailIds := newTestEnforcer(t, false, testPolicies, testGroupings).CachedEmails(); len(emailIds) != 0 {
+		t.Errorf("CachedEmails() with cache disabled = %v, want none", emailIds)
+	}
+}
+
+func TestCacheSlidingExpiration(t *testing.T) {
+	tests := []struct {
+		name      string
+		sliding   string
+		wantFound bool
+	}{
+		{name: "sliding expiration restarts on read", sliding: "true", wantFound: true},
+		{name: "absolute expiration", sliding: "false", wantFound: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENFORCER_CACHE_EXPIRATION_IN_SEC", "1")
+			t.Setenv("ENFORCER_CACHE_SLIDING_EXPIRATION", tt.sliding)
+			enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+			storeCacheData(enforcer, "user@example.com", "applications", "get", map[string]bool{"team1/app1": true})
+			time.Sleep(600 * time.Millisecond)
+			if result := getCacheData(enforcer, "user@example.com", "applications", "get"); result == nil {
+				t.Fatalf("entry expired before its expiration")
+			}
+			time.Sleep(600 * time.Millisecond)
+			result := getCacheData(enforcer, "user@example.com", "applications", "get")
+			if found := result != nil; found != tt.wantFound {
+				t.Errorf("entry found after the absolute expiration = %v, want %v", found, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestEnforceByEmailInBatchWithProgress(t *testing.T) {
+	t.Setenv("ENFORCER_MAX_BATCH_SIZE", "4")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	storeCacheData(enforcer, "user@example.com", "applications", "get", map[string]bool{"team2/cached": true})
+	var vals []string
+	for i := 0; i < 50; i++ {
+		vals = append(vals, fmt.Sprintf("team%d/app%d", i%4, i))
+	}
+	vals = append(vals, "team2/cached")
+
+	var reports [][2]int
+	result := enforcer.EnforceByEmailInBatchWithProgress("user@example.com", "applications", "get", vals, func(done, total int) {
+		reports = append(reports, [2]int{done, total})
+	})
+	if len(result) != len(vals) {
+		t.Fatalf("result size = %d, want %d", len(result), len(vals))
+	}
+	if len(reports) == 0 {
+		t.Fatalf("progress never called")
+	}
+	previous := 0
+	for _, report := range reports {
+		done, total := report[0], report[1]
+		if total != len(vals) {
+			t.Errorf("progress total = %d, want %d", total, len(vals))
+		}
+		if done < previous {
+			t.Errorf("progress done decreased from %d to %d", previous, done)
+		}
+		previous = done
+	}
+	if previous != len(vals) {
+		t.Errorf("final progress done = %d, want %d", previous, len(vals))
+	}
+}
+
+func TestEnforceByEmailMixedBatch(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, append(testPolicies,
+		[]string{"user@example.com", "environment", "trigger", "env1/*", "allow"},
+	), testGroupings)
+	checks := []ResourceActionObject{
+		{Resource: "applications", Action: "get", Object: "team1/app1"},
+		{Resource: "applications", Action: "get", Object: "team2/app2"},
+		{Resource: "applications", Action: "delete", Object: "team3/app1"},
+		{Resource: "applications", Action: "delete", Object: "team1/app1"},
+		{Resource: "environment", Action: "trigger", Object: "env1/app1"},
+		{Resource: "environment", Action: "trigger", Object: "env2/app1"},
+		{Resource: "environment", Action: "get", Object: "env1/app1"},
+	}
+	want := map[ResourceActionObject]bool{
+		checks[0]: true, checks[1]: false, checks[2]: true, checks[3]: false,
+		checks[4]: true, checks[5]: false, checks[6]: false,
+	}
+	if got, err := enforcer.EnforceByEmailMixedBatch("user@example.com", checks); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("EnforceByEmailMixedBatch() = %v, %v, want %v", got, err, want)
+	}
+	if cached := getCacheData(enforcer, "user@example.com", "environment", "trigger"); !reflect.DeepEqual(cached, map[string]bool{"env1/app1": true, "env2/app1": false}) {
+		t.Errorf("cached environment trigger results = %v", cached)
+	}
+}
+
+func TestEnforceByEmailMixedBatchGroupError(t *testing.T) {
+	t.Setenv("ENFORCER_STRICT_RESOURCES", "true")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	checks := []ResourceActionObject{
+		{Resource: "applications", Action: "get", Object: "team1/app1"},
+		{Resource: "applicatoins", Action: "get", Object: "team1/app1"},
+	}
+	got, err := enforcer.EnforceByEmailMixedBatch("user@example.com", checks)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("EnforceByEmailMixedBatch() with an unknown resource error = %v, want %v", err, codes.InvalidArgument)
+	}
+	if want := map[ResourceActionObject]bool{checks[0]: true, checks[1]: false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EnforceByEmailMixedBatch() with an unknown resource = %v, want %v", got, want)
+	}
+	if _, err := enforcer.AllowedActions("user@example.com", "applicatoins", "team1/app1", []string{"get"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("AllowedActions() of an unknown resource error = %v, want %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestSlowEnforcementLogging(t *testing.T) {
+	t.Setenv("ENFORCER_SLOW_ENFORCEMENT_THRESHOLD_IN_MS", "20")
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": slowMatcher(30 * time.Millisecond)}, testPolicies, testGroupings)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	recorder, logger := newLogRecorder()
+	enforcer.logger = logger
+
+	enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1", "team2/app1"})
+	if level, found := recorder.levelOf("slow enforce request for batch"); !found || level != zapcore.WarnLevel {
+		t.Errorf("slow batch logged = %v at %v, want %v", found, level, zapcore.WarnLevel)
+	}
+	enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1")
+	if level, found := recorder.levelOf("slow enforce request"); !found || level != zapcore.WarnLevel {
+		t.Errorf("slow enforcement logged = %v at %v, want %v", found, level, zapcore.WarnLevel)
+	}
+
+	fast := newTestEnforcer(t, false, testPolicies, testGroupings)
+	recorder, logger = newLogRecorder()
+	fast.logger = logger
+	fast.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1"})
+	if _, found := recorder.levelOf("slow enforce request for batch"); found {
+		t.Errorf("fast batch logged as slow")
+	}
+	if level, found := recorder.levelOf("enforce request for batch with data"); !found || level != zapcore.DebugLevel {
+		t.Errorf("fast batch logged = %v at %v, want %v", found, level, zapcore.DebugLevel)
+	}
+}
+
+func TestSlowEnforcementLogOmitsToken(t *testing.T) {
+	t.Setenv("ENFORCER_SLOW_ENFORCEMENT_THRESHOLD_IN_MS", "20")
+	t.Setenv("ENFORCER_STRICT_RESOURCES", "true")
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	output := &bytes.Buffer{}
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(output), zapcore.DebugLevel)
+	enforcer.logger = zap.New(core).Sugar()
+	enforcer.SetSubjectResolver(func(raw string) string {
+		time.Sleep(30 * time.Millisecond)
+		return raw
+	})
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+
+	// the unknown resource fails the request before the token is replaced by its subject
+	enforcer.Enforce(token, "applicatoins", "get", "team1/app1")
+	enforcer.Enforce(token, "applications", "get", "team1/app1")
+	logged := output.String()
+	if strings.Count(logged, "slow enforce request") != 2 {
+		t.Fatalf("slow enforcements logged = %q, want 2", logged)
+	}
+	if strings.Contains(logged, token) {
+		t.Errorf("slow enforcement log holds the token: %s", logged)
+	}
+}
+
+func TestEmptyPolicyWarning(t *testing.T) {
+	const warning = "enforcer has no policies, every request is denied, check the policy store"
+	enforcer := newTestEnforcer(t, false, nil, nil)
+	recorder, logger := newLogRecorder()
+	enforcer.logger = logger
+	for i := 0; i < 3; i++ {
+		if enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1") {
+			t.Fatalf("EnforceByEmail allowed without policies")
+		}
+	}
+	enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1", "team1/app2"})
+	if count := recorder.count(warning); count != 1 {
+		t.Errorf("empty policy warning logged %d times, want 1", count)
+	}
+
+	loaded := newTestEnforcer(t, false, testPolicies, testGroupings)
+	recorder, logger = newLogRecorder()
+	loaded.logger = logger
+	loaded.EnforceByEmail("user@example.com", "applications", "get", "team4/app1")
+	if count := recorder.count(warning); count != 0 {
+		t.Errorf("empty policy warning logged %d times with policies loaded, want 0", count)
+	}
+}
+
+func TestSingleEnforceSharesBatchCache(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	if !enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1") {
+		t.Fatalf("EnforceByEmail of allowed object denied")
+	}
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+	if enforcer.Enforce(token, "applications", "get", "team4/app1") {
+		t.Fatalf("Enforce of denied object allowed")
+	}
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); !reflect.DeepEqual(cached, map[string]bool{"team1/app1": true, "team4/app1": false}) {
+		t.Fatalf("cached results after single enforcements = %v", cached)
+	}
+
+	enforcer.ResetStats()
+	result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1", "team4/app1", "team2/app1"})
+	if want := map[string]bool{"team1/app1": true, "team4/app1": false, "team2/app1": true}; !reflect.DeepEqual(result, want) {
+		t.Errorf("EnforceByEmailInBatch() = %v, want %v", result, want)
+	}
+	if stats := enforcer.Stats(); stats.CacheHits != 2 || stats.CacheMisses != 1 {
+		t.Errorf("batch after single enforcements stats = %+v, want 2 hits and 1 miss", stats)
+	}
+	if !enforcer.EnforceByEmail("user@example.com", "applications", "get", "team2/app1") || enforcer.Stats().CacheHits != 3 {
+		t.Errorf("EnforceByEmail of batch cached object not served from the cache, stats = %+v", enforcer.Stats())
+	}
+
+	enforcer.InvalidateCache("user@example.com")
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); cached != nil {
+		t.Errorf("cached results after invalidation = %v, want none", cached)
+	}
+}
+
+func TestCacheEntryOfUnexpectedType(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	recorder, logger := newLogRecorder()
+	enforcer.logger = logger
+	enforcer.Cache.Set("user@example.com", map[string]bool{"team1/app1": false}, cache.DefaultExpiration)
+
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); cached != nil {
+		t.Errorf("getCacheData() of unexpected entry = %v, want none", cached)
+	}
+	if recorder.count("ignoring cache entry of unexpected type") != 1 {
+		t.Errorf("unexpected cache entry not logged")
+	}
+	result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1", "team4/app1"})
+	if want := map[string]bool{"team1/app1": true, "team4/app1": false}; !reflect.DeepEqual(result, want) {
+		t.Errorf("EnforceByEmailInBatch() over unexpected entry = %v, want %v", result, want)
+	}
+	if !enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1") {
+		t.Errorf("EnforceByEmail() over unexpected entry denied")
+	}
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); !reflect.DeepEqual(cached, map[string]bool{"team1/app1": true, "team4/app1": false}) {
+		t.Errorf("cache entry after batch = %v, want the unexpected entry replaced", cached)
+	}
+}
+
+func TestIndependentEnforcers(t *testing.T) {
+	first := newTestEnforcer(t, true, testPolicies, testGroupings)
+	second := newTestEnforcer(t, true, [][]string{{"other@example.com", "applications", "get", "team9/*", "allow"}}, nil)
+	if GlobalEnforcerImpl() == first || GlobalEnforcerImpl() == second {
+		t.Fatalf("enforcer over an in-memory casbin enforcer registered globally")
+	}
+
+	if !first.EnforceByEmail("user@example.com", "applications", "get", "team1/app1") || first.EnforceByEmail("other@example.com", "applications", "get", "team9/app1") {
+		t.Errorf("first enforcer decisions do not follow its own policies")
+	}
+	if second.EnforceByEmail("user@example.com", "applications", "get", "team1/app1") || !second.EnforceByEmail("other@example.com", "applications", "get", "team9/app1") {
+		t.Errorf("second enforcer decisions do not follow its own policies")
+	}
+	second.EnforceByEmail("user@example.com", "applications", "get", "team2/app1")
+
+	first.InvalidateCache("user@example.com")
+	if cached := getCacheData(second, "user@example.com", "applications", "get"); len(cached) != 2 {
+		t.Errorf("second enforcer cache after invalidating the first = %v, want 2 entries", cached)
+	}
+
+	previous := GlobalEnforcerImpl()
+	defer SetGlobalEnforcerImpl(previous)
+	SetGlobalEnforcerImpl(second)
+	invalidateGlobalCache("user@example.com")
+	if cached := getCacheData(second, "user@example.com", "applications", "get"); cached != nil {
+		t.Errorf("registered enforcer cache after global invalidation = %v, want none", cached)
+	}
+}
+
+func TestEnforceByEmailPerObjectAction(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, append(testPolicies,
+		[]string{"user@example.com", "applications", "edit", "team1/app1", "allow"},
+	), testGroupings)
+	items := []ObjectAction{
+		{Object: "team1/app1", Action: "edit"},
+		{Object: "team1/app2", Action: "get"},
+		{Object: "team1/app3", Action: "edit"},
+		{Object: "team3/app1", Action: "delete"},
+		{Object: "team2/app1", Action: "get"},
+		{Object: "team2/app1", Action: "edit"},
+	}
+	want := map[string]bool{"team1/app1": true, "team1/app2": true, "team1/app3": false, "team3/app1": true, "team2/app1": false}
+	if got, err := enforcer.EnforceByEmailPerObjectAction("user@example.com", "applications", items); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("EnforceByEmailPerObjectAction() = %v, %v, want %v", got, err, want)
+	}
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "edit"); len(cached) != 3 {
+		t.Errorf("cached edit results = %v, want 3 entries", cached)
+	}
+}
+
+func TestEnforceByEmailInBatchDefaultAction(t *testing.T) {
+	t.Setenv("ENFORCER_DEFAULT_ACTION", "get")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	result, err := enforcer.EnforceByEmailInBatchWithContext(context.Background(), "user@example.com", "applications", "", []string{"team1/app1", "team4/app1"})
+	if err != nil {
+		t.Fatalf("EnforceByEmailInBatchWithContext() without action = %v", err)
+	}
+	if want := map[string]bool{"team1/app1": true, "team4/app1": false}; !reflect.DeepEqual(result, want) {
+		t.Errorf("EnforceByEmailInBatchWithContext() without action = %v, want %v", result, want)
+	}
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); len(cached) != 2 {
+		t.Errorf("results of default action cached as %v, want 2 entries under the default action", cached)
+	}
+	if allAllowed, firstDenied := enforcer.EnforceByEmailUntilDeny("user@example.com", "applications", "", []string{"team1/app1", "team2/app1"}); !allAllowed {
+		t.Errorf("EnforceByEmailUntilDeny() without action denied %s, want the default action", firstDenied)
+	}
+}
+
+func TestEnforceByEmailUntilDeny(t *testing.T) {
+	matcher := newCountingMatcher(0)
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": matcher.match}, testPolicies, testGroupings)
+	enforcer := newTestEnforcerFor(t, true, enf)
+
+	vals := []string{"team1/app1", "team4/app1", "team1/app2", "team1/app3", "team2/app1"}
+	allAllowed, firstDenied := enforcer.EnforceByEmailUntilDeny("user@example.com", "applications", "get", vals)
+	if allAllowed || firstDenied != "team4/app1" {
+		t.Errorf("EnforceByEmailUntilDeny() = %v, %q, want false, %q", allAllowed, firstDenied, "team4/app1")
+	}
+	for _, item := range vals[2:] {
+		if calls := matcher.callsFor(item); calls != 0 {
+			t.Errorf("object %s after the denial evaluated %d times, want 0", item, calls)
+		}
+	}
+
+	allAllowed, firstDenied = enforcer.EnforceByEmailUntilDeny("user@example.com", "applications", "get", []string{"team1/app1", "team2/app1", "team3/app1"})
+	if !allAllowed || firstDenied != "" {
+		t.Errorf("EnforceByEmailUntilDeny() of allowed objects = %v, %q, want true", allAllowed, firstDenied)
+	}
+	if allAllowed, firstDenied = enforcer.EnforceByEmailUntilDeny("user@example.com", "applications", "get", []string{"team1/app1", "team4/app1"}); allAllowed || firstDenied != "team4/app1" {
+		t.Errorf("EnforceByEmailUntilDeny() of cached denial = %v, %q, want false, %q", allAllowed, firstDenied, "team4/app1")
+	}
+}
+
+func TestEnforceByEmailUntilDenyChecks(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	tests := []struct {
+		name        string
+		emailId     string
+		resource    string
+		vals        []string
+		wantDenied  string
+		wantAllowed bool
+	}{
+		{name: "empty object", emailId: "nobody@example.com", resource: "applications", vals: []string{""}},
+		{name: "empty object before a denied one", emailId: "nobody@example.com", resource: "applications", vals: []string{"", "team9/x"}},
+		{name: "denied object after allowed ones", emailId: "user@example.com", resource: "applications", vals: []string{"team1/app1", "team1/app2", "team9/x"}, wantDenied: "team9/x"},
+		{name: "empty email", resource: "applications", vals: []string{"team1/app1"}},
+		{name: "empty resource", emailId: "user@example.com", vals: []string{"team1/app1"}},
+		{name: "mixed case email", emailId: "User@Example.com", resource: "applications", vals: []string{"team1/app3"}, wantAllowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allAllowed, firstDenied := enforcer.EnforceByEmailUntilDeny(tt.emailId, tt.resource, "get", tt.vals)
+			if allAllowed != tt.wantAllowed || firstDenied != tt.wantDenied {
+				t.Errorf("EnforceByEmailUntilDeny() = %v, %q, want %v, %q", allAllowed, firstDenied, tt.wantAllowed, tt.wantDenied)
+			}
+		})
+	}
+	if !enforcer.IsCached("user@example.com", "applications", "get", "team1/app3") {
+		t.Errorf("decision of a mixed case email not cached under the lower cased email")
+	}
+
+	t.Setenv("ENFORCER_STRICT_RESOURCES", "true")
+	strict := newTestEnforcer(t, true, testPolicies, testGroupings)
+	if allAllowed, _ := strict.EnforceByEmailUntilDeny("user@example.com", "applicatoins", "get", []string{"team1/app1"}); allAllowed {
+		t.Errorf("EnforceByEmailUntilDeny() of an unknown resource allowed")
+	}
+}
+
+func TestEnforceSubject(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	if !enforcer.EnforceSubject("user@example.com", "applications", "delete", "team3/app1") {
+		t.Errorf("EnforceSubject of object allowed through the role denied")
+	}
+	if enforcer.EnforceSubject("user@example.com", "applications", "get", "team4/app1") {
+		t.Errorf("EnforceSubject of denied object allowed")
+	}
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); cached != nil {
+		t.Errorf("EnforceSubject cached %v, want nothing cached", cached)
+	}
+	enforcer.SetPrincipalDenyList([]string{"user@example.com"})
+	if enforcer.EnforceSubject("user@example.com", "applications", "delete", "team3/app1") {
+		t.Errorf("EnforceSubject of denied principal allowed")
+	}
+}
+
+func BenchmarkEnforceSubject(b *testing.B) {
+	b.Setenv("ENFORCER_CACHE", "false")
+	enforcer := NewEnforcerImpl(newTestCasbinEnforcer(testPolicies, testGroupings), testSessionManager, nopLogger)
+	b.Run("EnforceSubject", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			enforcer.EnforceSubject("user@example.com", "applications", "get", "team1/app1")
+		}
+	})
+	b.Run("EnforceByEmail", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1")
+		}
+	})
+}
+
+func TestWarmUser(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	objects := map[string][]string{
+		"applications": {"team1/app1", "team2/app1", "team3/app1", "team4/app1"},
+		"environment":  {"env1/app1"},
+	}
+	if err := enforcer.WarmUser("user@example.com", []string{"applications", "environment"}, []string{"get", "delete"}, objects); err != nil {
+		t.Fatalf("WarmUser() error = %v", err)
+	}
+
+	enforcer.ResetStats()
+	result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", objects["applications"])
+	if want := map[string]bool{"team1/app1": true, "team2/app1": true, "team3/app1": true, "team4/app1": false}; !reflect.DeepEqual(result, want) {
+		t.Errorf("EnforceByEmailInBatch() after warmup = %v, want %v", result, want)
+	}
+	if !enforcer.EnforceByEmail("user@example.com", "applications", "delete", "team3/app1") {
+		t.Errorf("EnforceByEmail() after warmup denied")
+	}
+	enforcer.EnforceByEmail("user@example.com", "environment", "delete", "env1/app1")
+	if stats := enforcer.Stats(); stats.CacheHits != 6 || stats.CacheMisses != 0 {
+		t.Errorf("stats after warmup = %+v, want 6 hits and no miss", stats)
+	}
+
+	disabled := newTestEnforcer(t, false, testPolicies, testGroupings)
+	if err := disabled.WarmUser("user@example.com", []string{"applications"}, []string{"get"}, objects); err != nil {
+		t.Errorf("WarmUser() with cache disabled error = %v", err)
+	}
+	if stats := disabled.Stats(); !reflect.DeepEqual(stats, (&EnforcerImpl{}).Stats()) {
+		t.Errorf("warmup with cache disabled evaluated objects, stats = %+v", stats)
+	}
+}
+
+func TestAddDenyPolicy(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	vals := []string{"team1/app1", "team1/secret", "team3/secret"}
+	if result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals); !result["team1/secret"] || !result["team3/secret"] {
+		t.Fatalf("EnforceByEmailInBatch() before deny = %v, want all allowed", result)
+	}
+
+	if !enforcer.AddDenyPolicy("User@example.com", "applications", "get", "team1/secret") {
+		t.Fatalf("AddDenyPolicy() of subject not added")
+	}
+	want := map[string]bool{"team1/app1": true, "team1/secret": false, "team3/secret": true}
+	if result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals); !reflect.DeepEqual(result, want) {
+		t.Errorf("EnforceByEmailInBatch() after subject deny = %v, want %v", result, want)
+	}
+
+	if !enforcer.AddDenyPolicy("role:team3-admin", "applications", "*", "team3/secret") {
+		t.Fatalf("AddDenyPolicy() of role not added")
+	}
+	want["team3/secret"] = false
+	if result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals); !reflect.DeepEqual(result, want) {
+		t.Errorf("EnforceByEmailInBatch() after role deny = %v, want %v", result, want)
+	}
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+	if enforcer.Enforce(token, "applications", "delete", "team3/secret") || !enforcer.Enforce(token, "applications", "delete", "team3/app1") {
+		t.Errorf("Enforce() does not apply the role deny over the role allow")
+	}
+
+	withoutGroupings := newTestEnforcer(t, true, testPolicies, nil)
+	if !withoutGroupings.AddDenyPolicy("user@example.com", "applications", "get", "team1/secret") {
+		t.Fatalf("AddDenyPolicy() without role links not added")
+	}
+	if withoutGroupings.EnforceByEmail("user@example.com", "applications", "get", "team1/secret") {
+		t.Errorf("EnforceByEmail() without role links does not apply the deny")
+	}
+}
+
+func TestEnforceAsRoles(t *testing.T) {
+	policies := append([][]string{
+		{"role:team3-viewer", "applications", "get", "team3/*", "allow"},
+		{"role:no-delete", "applications", "delete", "*", "deny"},
+	}, testPolicies...)
+	groupings := append([][]string{{"role:team3-restricted", "role:no-delete"}}, testGroupings...)
+	enforcer := newTestEnforcer(t, false, policies, groupings)
+	tests := []struct {
+		name   string
+		action string
+		roles  []string
+		want   bool
+	}{
+		{name: "without roles", action: "get", roles: nil, want: false},
+		{name: "without candidate role", action: "delete", roles: []string{"role:team3-viewer"}, want: false},
+		{name: "with candidate role", action: "delete", roles: []string{"role:team3-viewer", "role:team3-admin"}, want: true},
+		{name: "candidate role denying", action: "delete", roles: []string{"role:team3-admin", "role:no-delete"}, want: false},
+		{name: "candidate role inheriting a deny", action: "delete", roles: []string{"role:team3-admin", "role:team3-restricted"}, want: false},
+		{name: "deny of another action", action: "get", roles: []string{"role:team3-viewer", "role:no-delete"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := enforcer.EnforceAsRoles("applications", tt.action, "team3/app1", tt.roles); got != tt.want {
+				t.Errorf("EnforceAsRoles(%s, %v) = %v, want %v", tt.action, tt.roles, got, tt.want)
+			}
+		})
+	}
+	if roles, _ := enforcer.Enforcer.GetRolesForUser("user@example.com"); len(roles) != 1 {
+		t.Errorf("roles of user@example.com = %v, want them unchanged by previews", roles)
+	}
+}
+
+func TestEnforceAsRolesNormalizesLikeEnforceByEmail(t *testing.T) {
+	groupings := [][]string{{"user@example.com", "role:team3-admin"}}
+	tests := []struct {
+		name            string
+		caseInsensitive string
+		resource        string
+		object          string
+	}{
+		{name: "upper case object", caseInsensitive: "false", resource: "applications", object: "Team3/app1"},
+		{name: "upper case resource", caseInsensitive: "false", resource: "Applications", object: "team3/app1"},
+		{name: "upper case resource with case insensitive keys", caseInsensitive: "true", resource: "Applications", object: "team3/app1"},
+		{name: "upper case object with case insensitive keys", caseInsensitive: "true", resource: "applications", object: "Team3/app1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENFORCER_CASE_INSENSITIVE_KEYS", tt.caseInsensitive)
+			enforcer := newTestEnforcer(t, false, testPolicies, groupings)
+			want := enforcer.EnforceByEmail("user@example.com", tt.resource, "get", tt.object)
+			if got := enforcer.EnforceAsRoles(tt.resource, "get", tt.object, []string{"role:team3-admin"}); got != want {
+				t.Errorf("EnforceAsRoles(%s, %s) = %v, EnforceByEmail = %v", tt.resource, tt.object, got, want)
+			}
+		})
+	}
+}
+
+func TestGetPoliciesForObject(t *testing.T) {
+	policies := append([][]string{
+		{"role:super-admin", "*", "*", "*", "allow"},
+		{"role:no-delete", "applications", "delete", "team3/app*", "deny"},
+	}, testPolicies...)
+	enforcer := newTestEnforcer(t, false, policies, testGroupings)
+	got := enforcer.GetPoliciesForObject("Team3/App1")
+	want := [][]string{
+		{"role:super-admin", "*", "*", "*", "allow"},
+		{"role:no-delete", "applications", "delete", "team3/app*", "deny"},
+		{"role:team3-admin", "applications", "*", "team3/*", "allow"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetPoliciesForObject() = %v, want %v", got, want)
+	}
+	got[0][0] = "changed"
+	if policy := enforcer.Enforcer.GetPolicy()[0]; policy[0] != "role:super-admin" {
+		t.Errorf("loaded policy modified through the returned one, got %v", policy)
+	}
+	if got := enforcer.GetPoliciesForObject("team9/app1"); len(got) != 1 {
+		t.Errorf("GetPoliciesForObject() of an object only the super admin grants = %v, want 1 policy", got)
+	}
+}
+
+func TestEnforceSubjectsForObject(t *testing.T) {
+	t.Setenv("ENFORCER_MAX_BATCH_SIZE", "3")
+	policies := append([][]string{
+		{"viewer@example.com", "applications", "get", "team3/app1", "allow"},
+		{"blocked@example.com", "applications", "get", "*", "deny"},
+	}, testPolicies...)
+	groupings := append([][]string{{"blocked@example.com", "role:team3-admin"}, {"admin@example.com", "role:team3-admin"}}, testGroupings...)
+	enforcer := newTestEnforcer(t, true, policies, groupings)
+	subjects := []string{"user@example.com", "Viewer@example.com", "blocked@example.com", "admin@example.com", "nobody@example.com"}
+	got := enforcer.EnforceSubjectsForObject(subjects, "applications", "get", "team3/app1")
+	want := map[string]bool{
+		"user@example.com":    true,
+		"Viewer@example.com":  true,
+		"blocked@example.com": false,
+		"admin@example.com":   true,
+		"nobody@example.com":  false,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EnforceSubjectsForObject() = %v, want %v", got, want)
+	}
+	if allowed, found := getCachedObject(enforcer, "viewer@example.com", "applications", "get", "team3/app1"); !found || !allowed {
+		t.Errorf("cached decision of viewer@example.com = %v, %v, want a cached allow", allowed, found)
+	}
+	enforcer.ResetStats()
+	enforcer.EnforceSubjectsForObject(subjects, "applications", "get", "team3/app1")
+	if stats := enforcer.Stats(); stats.CacheHits != int64(len(subjects)) || stats.CacheMisses != 0 {
+		t.Errorf("stats of repeated enforcement = %+v, want every subject served from the cache", stats)
+	}
+}
+
+func TestEnforceSubjectsForObjectDefaultAction(t *testing.T) {
+	t.Setenv("ENFORCER_DEFAULT_ACTION", "get")
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	got := enforcer.EnforceSubjectsForObject([]string{"user@example.com", "nobody@example.com"}, "applications", "", "team1/app1")
+	if want := map[string]bool{"user@example.com": true, "nobody@example.com": false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EnforceSubjectsForObject() without action = %v, want the decisions of the default action %v", got, want)
+	}
+}
+
+func TestEnforceSubjectsForObjectWithoutBatchSlot(t *testing.T) {
+	t.Setenv("ENFORCER_MAX_BATCH_SIZE", "2")
+	t.Setenv("ENFORCER_MAX_BATCH_GOROUTINES", "1")
+	t.Setenv("ENFORCER_BATCH_TIMEOUT_IN_MS", "20")
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	// another batch holding the only slot
+	enforcer.acquireBatchSlot(context.Background())
+	defer enforcer.releaseBatchSlot()
+	subjects := []string{"user@example.com", "admin@example.com", "nobody@example.com"}
+	done := make(chan map[string]bool)
+	go func() {
+		done <- enforcer.EnforceSubjectsForObject(subjects, "applications", "get", "team1/app1")
+	}()
+	select {
+	case got := <-done:
+		if want := map[string]bool{"user@example.com": false, "admin@example.com": false, "nobody@example.com": false}; !reflect.DeepEqual(got, want) {
+			t.Errorf("EnforceSubjectsForObject() without a batch slot = %v, want every subject denied %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("EnforceSubjectsForObject() still waiting for a batch slot after the batch timeout")
+	}
+}
+
+func TestEnforceAgainst(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	const hierarchyModel = `
+[request_definition]
+r = sub, res, act, obj
+
+[policy_definition]
+p = sub, res, act, obj, eft
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[role_definition]
+g = _, _
+
+[matchers]
+m = g(r.sub, p.sub) && matchKeyByPart(r.res, p.res) && matchKeyByPart(r.act, p.act) && matchResourceHierarchy(r.obj, p.obj)
+`
+	proposed := newTestCasbinEnforcerWithModel(hierarchyModel, map[string]matcherFunc{"matchResourceHierarchy": MatchResourceHierarchyFunc},
+		[][]string{{"user@example.com", "applications", "get", "team4", "allow"}}, nil)
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+
+	if enforcer.EnforceAgainst(enforcer.Enforcer, token, "applications", "get", "team4/app1") {
+		t.Errorf("EnforceAgainst() live enforcer allowed object granted only by the proposed policy")
+	}
+	if !enforcer.EnforceAgainst(proposed, token, "applications", "get", "team4/app1") {
+		t.Errorf("EnforceAgainst() proposed enforcer denied object granted by its policy")
+	}
+	if enforcer.EnforceAgainst(proposed, token, "applications", "get", "team1/app1") {
+		t.Errorf("EnforceAgainst() proposed enforcer allowed object granted only by the live policy")
+	}
+	if _, found := getCachedObject(enforcer, "user@example.com", "applications", "get", "team1/app1"); found {
+		t.Errorf("decision against the proposed enforcer cached")
+	}
+	if !enforcer.Enforce(token, "applications", "get", "team1/app1") {
+		t.Errorf("Enforce() affected by evaluation against the proposed enforcer")
+	}
+}
+
+func TestBatchDoesNotMutateVals(t *testing.T) {
+	t.Setenv("ENFORCER_MAX_BATCH_SIZE", "3")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	vals := []string{"team4/app1", "team2/app1", "team1/app2", "team1/app1", "team2/app1", "team3/app1", "bad"}
+	captured := append([]string{}, vals...)
+	calls := map[string]func(){
+		"EnforceByEmailInBatch": func() { enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals) },
+		"EnforceByEmailInBatchN": func() {
+			enforcer.EnforceByEmailInBatchN("user@example.com", "applications", "get", vals, 2)
+		},
+		"EnforceByEmailInBatchWithContext": func() {
+			_, _ = enforcer.EnforceByEmailInBatchWithContext(context.Background(), "user@example.com", "applications", "get", vals)
+		},
+		"EnforceByEmailInBatchDetailed": func() {
+			enforcer.EnforceByEmailInBatchDetailed("user@example.com", "applications", "get", vals)
+		},
+		"EnforceByEmailInBatchWithProgress": func() {
+			enforcer.EnforceByEmailInBatchWithProgress("user@example.com", "applications", "get", vals, func(done, total int) {})
+		},
+		"EnforceByEmailUntilDeny": func() { enforcer.EnforceByEmailUntilDeny("user@example.com", "applications", "get", vals) },
+		"GetAllowedObjectsSorted": func() {
+			enforcer.GetAllowedObjectsSorted("user@example.com", "applications", "get", vals)
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			enforcer.InvalidateCache("user@example.com")
+			call()
+			// second call is served partly from the cache
+			call()
+			if !reflect.DeepEqual(vals, captured) {
+				t.Errorf("%s changed vals to %v, want %v", name, vals, captured)
+			}
+		})
+	}
+}
+
+func TestEnforceByEmailInBatchEmptyObjects(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	recorder, logger := newLogRecorder()
+	enforcer.logger = logger
+	vals := []string{"team1/app1", "", "team4/app1", ""}
+
+	result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals)
+	if want := map[string]bool{"team1/app1": true, "team4/app1": false}; !reflect.DeepEqual(result, want) {
+		t.Errorf("EnforceByEmailInBatch() with empty objects = %v, want %v", result, want)
+	}
+	if recorder.count("skipping empty objects of batch enforcement") != 1 {
+		t.Errorf("empty objects not logged")
+	}
+	decisions := enforcer.EnforceByEmailInBatchDetailed("user@example.com", "applications", "get", vals)
+	if decision, found := decisions[""]; !found || decision.Allowed || status.Code(decision.Err) != codes.InvalidArgument {
+		t.Errorf("detailed decision of empty object = %+v, %v, want %v error", decision, found, codes.InvalidArgument)
+	}
+	if decision := decisions["team4/app1"]; decision.Allowed || decision.Err != nil {
+		t.Errorf("detailed decision of denied object = %+v, want denied without error", decision)
+	}
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); len(cached) != 2 {
+		t.Errorf("cached results = %v, want empty objects not cached", cached)
+	}
+}
+
+func TestPrimeCacheBatch(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	storeCacheData(enforcer, "user@example.com", "applications", "get", map[string]bool{"team1/app1": true})
+	enforcer.PrimeCacheBatch("user@example.com", map[string]map[string]bool{
+		"applications$$get":    {"team1/app2": true, "team9/app1": false},
+		"applications$$delete": {"team3/app1": true},
+		"environment$$trigger": {"env1/app1": true},
+	})
+
+	enforcer.ResetStats()
+	result := enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", []string{"team1/app1", "team1/app2", "team9/app1"})
+	if want := map[string]bool{"team1/app1": true, "team1/app2": true, "team9/app1": false}; !reflect.DeepEqual(result, want) {
+		t.Errorf("EnforceByEmailInBatch() after priming = %v, want %v", result, want)
+	}
+	enforcer.EnforceByEmail("user@example.com", "applications", "delete", "team3/app1")
+	if !enforcer.EnforceByEmail("user@example.com", "environment", "trigger", "env1/app1") {
+		t.Errorf("EnforceByEmail() of primed decision denied")
+	}
+	if stats := enforcer.Stats(); stats.CacheHits != 5 || stats.CacheMisses != 0 {
+		t.Errorf("stats after priming = %+v, want 5 hits and no miss", stats)
+	}
+}
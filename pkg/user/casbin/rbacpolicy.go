@@ -53,5 +53,13 @@ const (
 	ActionExec    = "exec"
 
 	EnforcerBatchDefaultSize       = 1
+	EnforcerBatchMaxSize           = 64
 	EnforcerCacheDefaultExpiration = time.Minute * 60
 )
+
+// resourceObjectSegmentCount is the number of "/" separated segments in the objects of path style resources
+var resourceObjectSegmentCount = map[string]int{
+	ResourceApplications: 2, // team/app
+	ResourceEnvironment:  2, // environment/app
+	ResourceHelmApp:      3, // team/environment/app
+}
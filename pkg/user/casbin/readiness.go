@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrPolicyNotLoaded is returned by enforcements which waited ENFORCER_POLICY_LOAD_TIMEOUT_IN_MS for the initial
+// policy load, see EnforcerConfig.WaitForPolicyLoad. Bool returning enforce functions deny instead
+var ErrPolicyNotLoaded = status.Error(codes.Unavailable, "enforcer policies are not loaded yet")
+
+// MarkPolicyLoaded signals that the initial policy load completed, releasing the enforcements waiting for it.
+// Enforcers not configured with ENFORCER_WAIT_FOR_POLICY_LOAD, or wrapping the already loaded casbin enforcer
+// built by Create, are marked on creation, LoadPolicy marks the enforcer registered through SetGlobalEnforcerImpl.
+// Further calls have no effect
+func (e *EnforcerImpl) MarkPolicyLoaded() {
+	e.policyLoadedOnce.Do(func() {
+		close(e.policyLoaded)
+	})
+}
+
+// PolicyLoaded tells whether MarkPolicyLoaded was called, e.g. for a readiness probe
+func (e *EnforcerImpl) PolicyLoaded() bool {
+	select {
+	case <-e.policyLoaded:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitPolicyLoaded blocks until MarkPolicyLoaded is called, ctx is done or the policy load timeout passes
+func (e *EnforcerImpl) waitPolicyLoaded(ctx context.Context) error {
+	if e.PolicyLoaded() {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(e.config.PolicyLoadTimeoutInMs) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-e.policyLoaded:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return ErrPolicyNotLoaded
+	}
+}
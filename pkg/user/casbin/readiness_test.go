@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestPolicyLoadGate(t *testing.T) {
+	t.Setenv("ENFORCER_WAIT_FOR_POLICY_LOAD", "true")
+	t.Setenv("ENFORCER_POLICY_LOAD_TIMEOUT_IN_MS", "5000")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	if enforcer.PolicyLoaded() {
+		t.Fatalf("PolicyLoaded() = true before MarkPolicyLoaded")
+	}
+
+	decided := make(chan bool)
+	go func() {
+		decided <- enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1")
+	}()
+	select {
+	case allowed := <-decided:
+		t.Fatalf("EnforceByEmail() = %v before the policy load, want it to wait", allowed)
+	case <-time.After(50 * time.Millisecond):
+	}
+	enforcer.MarkPolicyLoaded()
+	select {
+	case allowed := <-decided:
+		if !allowed {
+			t.Errorf("EnforceByEmail() after the policy load denied")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("EnforceByEmail() still waiting after MarkPolicyLoaded")
+	}
+	enforcer.MarkPolicyLoaded()
+	if !enforcer.PolicyLoaded() {
+		t.Errorf("PolicyLoaded() = false after MarkPolicyLoaded")
+	}
+}
+
+func TestPolicyLoadGateTimeout(t *testing.T) {
+	t.Setenv("ENFORCER_WAIT_FOR_POLICY_LOAD", "true")
+	t.Setenv("ENFORCER_POLICY_LOAD_TIMEOUT_IN_MS", "20")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+
+	if enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1") {
+		t.Errorf("EnforceByEmail() before the policy load allowed")
+	}
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+	if _, _, err := enforcer.EnforceResolve(token, "applications", "get", "team1/app1"); err != ErrPolicyNotLoaded {
+		t.Errorf("EnforceResolve() error = %v, want %v", err, ErrPolicyNotLoaded)
+	}
+	result, err := enforcer.EnforceByEmailInBatchWithContext(context.Background(), "user@example.com", "applications", "get", []string{"team1/app1"})
+	if err != ErrPolicyNotLoaded || len(result) != 0 {
+		t.Errorf("EnforceByEmailInBatchWithContext() = %v, %v, want no results and %v", result, err, ErrPolicyNotLoaded)
+	}
+
+	enforcer.MarkPolicyLoaded()
+	if !enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1") {
+		t.Errorf("EnforceByEmail() after the policy load denied, the not loaded decision was cached")
+	}
+}
+
+func TestPolicyLoadGateDisabled(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	if !enforcer.PolicyLoaded() {
+		t.Errorf("PolicyLoaded() = false without ENFORCER_WAIT_FOR_POLICY_LOAD")
+	}
+}
+
+func TestPolicyLoadGateOfCreatedEnforcer(t *testing.T) {
+	t.Setenv("ENFORCER_WAIT_FOR_POLICY_LOAD", "true")
+	t.Setenv("ENFORCER_POLICY_LOAD_TIMEOUT_IN_MS", "20")
+	previous, previousImpl := e, GlobalEnforcerImpl()
+	defer func() {
+		e = previous
+		SetGlobalEnforcerImpl(previousImpl)
+	}()
+	// standing in for the enforcer of Create, which loaded its policies before returning
+	e = newTestCasbinEnforcer(testPolicies, testGroupings)
+	enforcer := NewEnforcerImpl(e, testSessionManager, nopLogger)
+	if !enforcer.PolicyLoaded() {
+		t.Fatalf("PolicyLoaded() of the created enforcer = false, want it marked on creation")
+	}
+	if !enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1") {
+		t.Errorf("EnforceByEmail() of the created enforcer denied")
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultResources are registered on every enforcer, handlers enforcing other resources have to register them
+// through RegisterResources for ENFORCER_STRICT_RESOURCES
+var defaultResources = []string{
+	ResourceCluster, ResourceGlobalEnvironment, ResourceEnvironment, ResourceGit, ResourceDocker, ResourceMigrate,
+	ResourceUser, ResourceNotification, ResourceTemplate, ResourceTerminal, ResourceProjects, ResourceApplications,
+	ResourceDockerAuto, ResourceGitAuto, ResourceAutocomplete, ResourceChartGroup, ResourceTeam, ResourceAdmin,
+	ResourceGlobal, ResourceHelmApp,
+}
+
+// knownResources is the set of resources accepted by enforcement in strict mode
+type knownResources struct {
+	mutex sync.RWMutex
+	names map[string]bool
+}
+
+// RegisterResources adds names to the resources known to the enforcer
+func (e *EnforcerImpl) RegisterResources(names ...string) {
+	e.resources.mutex.Lock()
+	defer e.resources.mutex.Unlock()
+	if e.resources.names == nil {
+		e.resources.names = make(map[string]bool, len(names))
+	}
+	for _, name := range names {
+		e.resources.names[strings.ToLower(name)] = true
+	}
+}
+
+// checkResource returns codes.InvalidArgument for a resource which was never registered, when
+// ENFORCER_STRICT_RESOURCES is set. A typo in a handler's resource would otherwise be a silent deny
+func (e *EnforcerImpl) checkResource(resource string) error {
+	if !e.config.StrictResources {
+		return nil
+	}
+	e.resources.mutex.RLock()
+	defer e.resources.mutex.RUnlock()
+	if !e.resources.names[strings.ToLower(resource)] {
+		return status.Errorf(codes.InvalidArgument, "unknown resource %q", resource)
+	}
+	return nil
+}
+
+// checkResourceOf is checkResource for enforce rvals, whose resource follows the subject
+func (e *EnforcerImpl) checkResourceOf(rvals []interface{}) error {
+	if len(rvals) < 2 {
+		return nil
+	}
+	resource, _ := rvals[1].(string)
+	return e.checkResource(resource)
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStrictResources(t *testing.T) {
+	t.Setenv("ENFORCER_STRICT_RESOURCES", "true")
+	enforcer := newTestEnforcer(t, true, append(testPolicies,
+		[]string{"user@example.com", "reports", "get", "*", "allow"},
+	), testGroupings)
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+
+	err := enforcer.EnforceAuthErr(token, "applicatoins", "get", "team1/app1")
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("EnforceAuthErr of unknown resource = %v, want %v", err, codes.InvalidArgument)
+	}
+	if _, err := enforcer.enforceByEmailE(enforcer.Enforcer, "user@example.com", "reports", "get", "r1"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("enforceByEmailE of unregistered resource = %v, want %v", err, codes.InvalidArgument)
+	}
+	result, err := enforcer.EnforceByEmailInBatchWithContext(context.Background(), "user@example.com", "reports", "get", []string{"r1"})
+	if status.Code(err) != codes.InvalidArgument || len(result) != 0 {
+		t.Errorf("batch of unregistered resource = %v, %v, want no results and %v", result, err, codes.InvalidArgument)
+	}
+	if err := enforcer.EnforceAuthErr(token, "applications", "get", "team1/app1"); err != nil {
+		t.Errorf("EnforceAuthErr of default resource = %v, want nil", err)
+	}
+
+	enforcer.RegisterResources("Reports")
+	if !enforcer.EnforceByEmail("user@example.com", "reports", "get", "r1") {
+		t.Errorf("EnforceByEmail of registered resource denied")
+	}
+}
+
+func TestStrictResourcesDisabled(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	if _, err := enforcer.enforceByEmailE(enforcer.Enforcer, "user@example.com", "applicatoins", "get", "team1/app1"); err != nil {
+		t.Errorf("enforceByEmailE of unknown resource without strict mode = %v, want nil", err)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ResourcePath is a resource followed by the segments of one of its objects, built by NewResourcePath instead
+// of concatenating the "/" separated paths matched by MatchKeyByPart
+type ResourcePath struct {
+	parts []string
+}
+
+// NewResourcePath builds the path of resource's object made of segments, e.g.
+// NewResourcePath(ResourceApplications, team, app) for the object team + "/" + app of applications
+func NewResourcePath(resource string, segments ...string) ResourcePath {
+	return ResourcePath{parts: append([]string{resource}, segments...)}
+}
+
+// Resource returns the resource of the path
+func (p ResourcePath) Resource() string {
+	if len(p.parts) == 0 {
+		return ""
+	}
+	return p.parts[0]
+}
+
+// Object returns the "/" separated segments following the resource
+func (p ResourcePath) Object() string {
+	if len(p.parts) < 2 {
+		return ""
+	}
+	return strings.Join(p.parts[1:], "/")
+}
+
+// String returns the complete "/" separated path, resource included
+func (p ResourcePath) String() string {
+	return strings.Join(p.parts, "/")
+}
+
+// Err returns codes.InvalidArgument for a path without object segments, or with an empty part or a part
+// containing "/", which would not match the policies its parts are meant for
+func (p ResourcePath) Err() error {
+	if len(p.parts) < 2 {
+		return status.Errorf(codes.InvalidArgument, "resource path %q has no object", p.String())
+	}
+	for _, part := range p.parts {
+		if part == "" || strings.Contains(part, "/") {
+			return status.Errorf(codes.InvalidArgument, "resource path %q has an invalid part %q", p.String(), part)
+		}
+	}
+	return nil
+}
+
+// EnforceByEmailResource is EnforceByEmail for the resource and object of path, paths failing Err are denied
+func (e *EnforcerImpl) EnforceByEmailResource(email string, action string, path ResourcePath) bool {
+	if err := path.Err(); err != nil {
+		e.logger.Errorw("denying enforce of invalid resource path", "email", email, "action", action, "err", err)
+		return false
+	}
+	return e.EnforceByEmail(email, path.Resource(), action, path.Object())
+}
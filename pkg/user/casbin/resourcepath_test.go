@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestResourcePath(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         ResourcePath
+		wantString   string
+		wantResource string
+		wantObject   string
+		wantValid    bool
+	}{
+		{name: "object segments", path: NewResourcePath("applications", "team1", "app1"), wantString: "applications/team1/app1",
+			wantResource: "applications", wantObject: "team1/app1", wantValid: true},
+		{name: "single segment", path: NewResourcePath("team", "team1"), wantString: "team/team1",
+			wantResource: "team", wantObject: "team1", wantValid: true},
+		{name: "no object", path: NewResourcePath("applications"), wantString: "applications",
+			wantResource: "applications", wantObject: "", wantValid: false},
+		{name: "empty segment", path: NewResourcePath("applications", "", "app1"), wantString: "applications//app1",
+			wantResource: "applications", wantObject: "/app1", wantValid: false},
+		{name: "segment with separator", path: NewResourcePath("applications", "team1/app1"), wantString: "applications/team1/app1",
+			wantResource: "applications", wantObject: "team1/app1", wantValid: false},
+		{name: "zero value", path: ResourcePath{}, wantString: "", wantResource: "", wantObject: "", wantValid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.path.String(); got != tt.wantString {
+				t.Errorf("String() = %q, want %q", got, tt.wantString)
+			}
+			if got := tt.path.Resource(); got != tt.wantResource {
+				t.Errorf("Resource() = %q, want %q", got, tt.wantResource)
+			}
+			if got := tt.path.Object(); got != tt.wantObject {
+				t.Errorf("Object() = %q, want %q", got, tt.wantObject)
+			}
+			err := tt.path.Err()
+			if (err == nil) != tt.wantValid {
+				t.Errorf("Err() = %v, want valid %v", err, tt.wantValid)
+			}
+			if err != nil && status.Code(err) != codes.InvalidArgument {
+				t.Errorf("Err() code = %v, want %v", status.Code(err), codes.InvalidArgument)
+			}
+		})
+	}
+}
+
+func TestEnforceByEmailResource(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	tests := []struct {
+		name   string
+		action string
+		path   ResourcePath
+		want   bool
+	}{
+		{name: "allowed", action: "get", path: NewResourcePath("applications", "team1", "app1"), want: true},
+		{name: "allowed through a role", action: "delete", path: NewResourcePath("applications", "team3", "app1"), want: true},
+		{name: "denied", action: "get", path: NewResourcePath("applications", "team4", "app1"), want: false},
+		{name: "invalid path matching a policy", action: "get", path: NewResourcePath("applications", "team1/app1"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := enforcer.EnforceByEmailResource("user@example.com", tt.action, tt.path); got != tt.want {
+				t.Errorf("EnforceByEmailResource(%s, %s) = %v, want %v", tt.action, tt.path, got, tt.want)
+			}
+		})
+	}
+}
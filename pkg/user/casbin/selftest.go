@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"fmt"
+
+	"github.com/casbin/casbin"
+)
+
+// selfTestPolicy is the policy SelfTest enforces selfTestAllowed and selfTestDenied against, its subject is not a
+// valid email so it can't collide with a user's policies
+var (
+	selfTestPolicy  = []string{"enforcer:self-test", "selftest", "get", "selftest/*", "allow"}
+	selfTestAllowed = []interface{}{"enforcer:self-test", "selftest", "get", "selftest/app"}
+	selfTestDenied  = []interface{}{"enforcer:self-test", "selftest", "get", "other/app"}
+)
+
+// SelfTest enforces a request selfTestPolicy allows and one it doesn't, failing unless both are decided as
+// expected, e.g. for liveness probes. They are evaluated by a scratch enforcer holding selfTestPolicy only, built
+// from the definitions of the live enforcer's model and the functions registered on it, so a model naming a matcher
+// the live enforcer lacks, or a broken matcher, fails the test. The live policies and cache are left untouched
+func (e *EnforcerImpl) SelfTest() error {
+	scratch, err := newSelfTestEnforcer(e.Enforcer)
+	if err != nil {
+		return err
+	}
+	// enforceActions leaves out the default role, only selfTestPolicy is evaluated
+	allowed, err := e.enforceActions(scratch, selfTestAllowed...)
+	if err != nil {
+		return fmt.Errorf("self test: enforcing the allowed request: %w", err)
+	}
+	if !allowed {
+		return fmt.Errorf("self test: request %v denied, want allowed", selfTestAllowed)
+	}
+	if allowed, err = e.enforceActions(scratch, selfTestDenied...); err != nil {
+		return fmt.Errorf("self test: enforcing the denied request: %w", err)
+	}
+	if allowed {
+		return fmt.Errorf("self test: request %v allowed, want denied", selfTestDenied)
+	}
+	return nil
+}
+
+// newSelfTestEnforcer builds an enforcer on the definitions of live's model and the functions registered on live,
+// holding selfTestPolicy only
+func newSelfTestEnforcer(live *casbin.Enforcer) (*casbin.Enforcer, error) {
+	m := casbin.NewModel()
+	for sec, assertions := range live.GetModel() {
+		for key, assertion := range assertions {
+			m.AddDef(sec, key, assertion.Value)
+		}
+	}
+	policyDefinition, found := m["p"]["p"]
+	if !found || len(policyDefinition.Tokens) != len(selfTestPolicy) {
+		return nil, fmt.Errorf("self test: model policies don't have the %d fields of sub, res, act, obj and eft", len(selfTestPolicy))
+	}
+	functions, err := registeredFunctions(live)
+	if err != nil {
+		return nil, fmt.Errorf("self test: %w", err)
+	}
+	scratch, err := casbin.NewEnforcerSafe(m)
+	if err != nil {
+		return nil, fmt.Errorf("self test: building the enforcer: %w", err)
+	}
+	for name, function := range functions {
+		scratch.AddFunction(name, function)
+	}
+	scratch.AddPolicy(selfTestPolicy)
+	return scratch, nil
+}
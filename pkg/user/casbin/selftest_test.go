@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/casbin/casbin"
+)
+
+func TestSelfTest(t *testing.T) {
+	embedded, err := NewEnforcerWithEmbeddedModel(nil)
+	if err != nil {
+		t.Fatalf("NewEnforcerWithEmbeddedModel() = %v", err)
+	}
+	modelWith := func(matcher string) string {
+		return strings.Replace(testModel, "matchKeyByPart(r.obj, p.obj)", matcher, 1)
+	}
+	tests := []struct {
+		name    string
+		enf     *casbin.Enforcer
+		wantErr bool
+	}{
+		{name: "embedded model", enf: embedded},
+		{name: "test model", enf: newTestCasbinEnforcer(testPolicies, testGroupings)},
+		{name: "matcher registered on the live enforcer only", enf: newTestCasbinEnforcerWithModel(slowMatchModel,
+			map[string]matcherFunc{"slowMatch": slowMatcher(0)}, testPolicies, testGroupings)},
+		{name: "unregistered matcher", enf: casbin.NewEnforcer(casbin.NewModel(modelWith("matchKeyByParts(r.obj, p.obj)"))), wantErr: true},
+		{name: "matcher allowing every object", enf: casbin.NewEnforcer(casbin.NewModel(modelWith("true"))), wantErr: true},
+		{name: "matcher denying every object", enf: casbin.NewEnforcer(casbin.NewModel(modelWith("r.obj == \"\""))), wantErr: true},
+		{name: "policies without effect", enf: casbin.NewEnforcer(casbin.NewModel(strings.Replace(
+			strings.Replace(testModel, "obj, eft", "obj", 1), "some(where (p.eft == allow)) && !some(where (p.eft == deny))", "some(where (p.eft == allow))", 1))), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enforcer := newTestEnforcerFor(t, true, tt.enf)
+			if err := enforcer.SelfTest(); (err != nil) != tt.wantErr {
+				t.Errorf("SelfTest() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	policies := len(enforcer.Enforcer.GetPolicy())
+	if err := enforcer.SelfTest(); err != nil {
+		t.Fatalf("SelfTest() = %v", err)
+	}
+	if got := len(enforcer.Enforcer.GetPolicy()); got != policies {
+		t.Errorf("SelfTest() changed the live policies from %d to %d", policies, got)
+	}
+
+	t.Setenv("ENFORCER_DEFAULT_ROLE", "role:admin")
+	withDefaultRole := newTestEnforcer(t, true, append(testPolicies, []string{"role:admin", "*", "*", "*", "allow"}), testGroupings)
+	if err := withDefaultRole.SelfTest(); err != nil {
+		t.Errorf("SelfTest() with a default role granting everything = %v", err)
+	}
+}
+
+func TestSelfTestConcurrentWithEnforcement(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := enforcer.SelfTest(); err != nil {
+				t.Errorf("SelfTest() = %v", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if !enforcer.EnforceByEmail("user@example.com", "applications", "get", "team1/app1") {
+				t.Errorf("EnforceByEmail() during SelfTest denied")
+			}
+			for _, policy := range enforcer.Enforcer.GetPolicy() {
+				if policy[0] == selfTestPolicy[0] {
+					t.Errorf("self test policy %v visible in the live policies", policy)
+				}
+			}
+		}
+	}()
+	wg.Wait()
+}
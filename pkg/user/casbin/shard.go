@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// cacheShard holds the per email locks of the emails hashing to it, and their cache entries. The first shard's
+// entries are held by EnforcerImpl.Cache, so that with a single shard Cache holds every entry
+type cacheShard struct {
+	lockMapMutex sync.Mutex
+	lock         map[string]*cacheLock
+	cache        *cache.Cache
+}
+
+// newCacheShards builds count shards, at least one, the shards after the first get their own cache when caching
+// is enabled
+func newCacheShards(count int, cacheEnabled bool) []*cacheShard {
+	if count < 1 {
+		count = 1
+	}
+	shards := make([]*cacheShard, count)
+	for i := range shards {
+		shards[i] = &cacheShard{lock: make(map[string]*cacheLock)}
+		if i > 0 && cacheEnabled {
+			shards[i].cache = newEnforcerCache()
+		}
+	}
+	return shards
+}
+
+func (e *EnforcerImpl) shardIndex(emailId string) int {
+	if len(e.shards) == 1 {
+		return 0
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(emailId))
+	return int(hash.Sum32() % uint32(len(e.shards)))
+}
+
+func (e *EnforcerImpl) shardOf(emailId string) *cacheShard {
+	return e.shards[e.shardIndex(emailId)]
+}
+
+// cacheOf returns the cache holding the entry of emailId, nil when caching is disabled
+func (e *EnforcerImpl) cacheOf(emailId string) *cache.Cache {
+	if index := e.shardIndex(emailId); index > 0 {
+		return e.shards[index].cache
+	}
+	return e.Cache
+}
+
+// caches returns the cache of every shard, none when caching is disabled
+func (e *EnforcerImpl) caches() []*cache.Cache {
+	if e.Cache == nil {
+		return nil
+	}
+	caches := []*cache.Cache{e.Cache}
+	for _, shard := range e.shards[1:] {
+		caches = append(caches, shard.cache)
+	}
+	return caches
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCacheShards(t *testing.T) {
+	t.Setenv("ENFORCER_CACHE_SHARDS", "4")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	var emailIds []string
+	for i := 0; i < 20; i++ {
+		emailId := fmt.Sprintf("user%d@example.com", i)
+		emailIds = append(emailIds, emailId)
+		storeCacheData(enforcer, emailId, "applications", "get", map[string]bool{"team1/app1": true})
+	}
+	sort.Strings(emailIds)
+	used := 0
+	for _, shardCache := range enforcer.caches() {
+		if shardCache.ItemCount() > 0 {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Errorf("entries of 20 emails held by %d of 4 shards, want them spread", used)
+	}
+	if cached := enforcer.CachedEmails(); !reflect.DeepEqual(cached, emailIds) {
+		t.Errorf("CachedEmails() = %v, want every shard's emails %v", cached, emailIds)
+	}
+	if allowed, found := getCachedObject(enforcer, "user7@example.com", "applications", "get", "team1/app1"); !found || !allowed {
+		t.Errorf("cached decision of user7@example.com = %v, %v, want a cached allow", allowed, found)
+	}
+
+	enforcer.InvalidateBySubjectPrefix("user1")
+	if cached := enforcer.CachedEmails(); len(cached) != 9 {
+		t.Errorf("CachedEmails() after prefix invalidation = %v, want the 9 emails not starting with user1", cached)
+	}
+	enforcer.InvalidateCompleteCache()
+	if cached := enforcer.CachedEmails(); len(cached) != 0 {
+		t.Errorf("CachedEmails() after complete invalidation = %v, want none", cached)
+	}
+}
+
+// BenchmarkCacheShards reads and writes the cache entries of distinct emails concurrently, they only contend on the
+// lock map and cache of their shard so more shards lower the time per operation
+func BenchmarkCacheShards(b *testing.B) {
+	for _, shards := range []string{"1", "16"} {
+		b.Run("shards-"+shards, func(b *testing.B) {
+			b.Setenv("ENFORCER_CACHE", "true")
+			b.Setenv("ENFORCER_CACHE_SHARDS", shards)
+			enforcer := NewEnforcerImpl(newTestCasbinEnforcer(testPolicies, testGroupings), testSessionManager, nopLogger)
+			var next int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				emailId := fmt.Sprintf("user%d@example.com", atomic.AddInt64(&next, 1))
+				for pb.Next() {
+					storeCacheData(enforcer, emailId, "applications", "get", map[string]bool{"team1/app1": true})
+					getCachedObject(enforcer, emailId, "applications", "get", "team1/app1")
+				}
+			})
+		})
+	}
+}
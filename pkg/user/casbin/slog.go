@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+// SlogLogger is the part of a log/slog *slog.Logger the enforcer logs to. It is declared here rather than taking
+// *slog.Logger so that the package builds with toolchains predating log/slog
+type SlogLogger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type slogLogger struct {
+	logger SlogLogger
+}
+
+// NewSlogLogger adapts logger, e.g. a *slog.Logger, to the enforcer's Logger, e.g. for NewEnforcerImplWithLogger
+func NewSlogLogger(logger SlogLogger) Logger {
+	return slogLogger{logger: logger}
+}
+
+func (l slogLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, keysAndValues...)
+}
+
+func (l slogLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.logger.Info(msg, keysAndValues...)
+}
+
+func (l slogLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.logger.Warn(msg, keysAndValues...)
+}
+
+func (l slogLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.logger.Error(msg, keysAndValues...)
+}
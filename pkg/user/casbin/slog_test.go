@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// slogRecord is a call to a slogRecorder, attrs holds the alternating keys and values
+type slogRecord struct {
+	level string
+	attrs map[interface{}]interface{}
+}
+
+// slogRecorder is a SlogLogger recording its calls by message
+type slogRecorder struct {
+	mutex   sync.Mutex
+	records map[string]slogRecord
+}
+
+func (r *slogRecorder) record(level string, msg string, args []interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	attrs := make(map[interface{}]interface{}, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		attrs[args[i]] = args[i+1]
+	}
+	r.records[msg] = slogRecord{level: level, attrs: attrs}
+}
+
+func (r *slogRecorder) Debug(msg string, args ...interface{}) { r.record("DEBUG", msg, args) }
+func (r *slogRecorder) Info(msg string, args ...interface{})  { r.record("INFO", msg, args) }
+func (r *slogRecorder) Warn(msg string, args ...interface{})  { r.record("WARN", msg, args) }
+func (r *slogRecorder) Error(msg string, args ...interface{}) { r.record("ERROR", msg, args) }
+
+func TestSlogLogger(t *testing.T) {
+	t.Setenv("ENFORCER_CACHE", "true")
+	recorder := &slogRecorder{records: make(map[string]slogRecord)}
+	enforcer := NewEnforcerImplWithLogger(newTestCasbinEnforcer(testPolicies, testGroupings), testSessionManager, NewSlogLogger(recorder))
+	enforcer.Enforce(newTestToken(t, jwt.MapClaims{"sub": "admin"}), "applications", "get", "team1/app1")
+
+	find := func(msg string) slogRecord {
+		record, found := recorder.records[msg]
+		if !found {
+			t.Fatalf("no slog record %q", msg)
+		}
+		return record
+	}
+	if record := find("enforce cache enabled"); record.level != "INFO" || record.attrs["expiry"] == nil {
+		t.Errorf("cache enabled record = %v, want INFO with expiry", record)
+	}
+	warning := find("admin subject has no policies, admin tokens are denied, grant it a role or set ENFORCER_ADMIN_AUTO_GRANT")
+	if warning.level != "WARN" || warning.attrs["subject"] != "admin" {
+		t.Errorf("admin warning record = %v, want WARN with subject admin", warning)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// EnforcerStats are the counters accumulated since the enforcer was created or ResetStats was last called
+type EnforcerStats struct {
+	// CacheHits and CacheMisses count batch objects found and not found in the cache
+	CacheHits   int64
+	CacheMisses int64
+	// LockContention counts cache lock acquisitions which had to wait for another goroutine
+	LockContention int64
+	// CacheTimeouts counts cache reads and stores given up after ENFORCER_CACHE_TIMEOUT_IN_MS
+	CacheTimeouts int64
+	// TokenEnforcements counts Enforce calls whose token was verified, VerifyDuration and PolicyDuration are the
+	// time they spent verifying tokens and evaluating the policy respectively
+	TokenEnforcements int64
+	VerifyDuration    time.Duration
+	PolicyDuration    time.Duration
+	// LastBatchDurationsInMs are the durations of the goroutines of the last batch which evaluated any object, one
+	// per goroutine in order of the objects they evaluated
+	LastBatchDurationsInMs []int64
+	// BatchSizes is the distribution of the number of objects requested per batch enforcement, e.g. to tune
+	// ENFORCER_MAX_BATCH_SIZE
+	BatchSizes []BatchSizeBucket
+}
+
+// BatchSizeBucket counts the batches requesting more objects than the previous bucket's MaxSize and up to its own,
+// the last bucket has a MaxSize of 0 and counts the batches larger than every other bucket
+type BatchSizeBucket struct {
+	MaxSize int
+	Count   int64
+}
+
+// batchSizeBuckets are the MaxSize of the BatchSizes buckets, the last one excluded
+var batchSizeBuckets = [...]int{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024}
+
+type enforcerCounters struct {
+	cacheHits         int64
+	cacheMisses       int64
+	lockContention    int64
+	cacheTimeouts     int64
+	tokenEnforcements int64
+	verifyNanos       int64
+	policyNanos       int64
+	// lastBatchDurations holds the []int64 of LastBatchDurationsInMs, replaced as a whole by every batch
+	lastBatchDurations atomic.Value
+	batchSizeCounts    [len(batchSizeBuckets) + 1]int64
+}
+
+// counters returns the live counters, ResetStats swaps them as a whole so a reset never interleaves with a
+// partially cleared set
+func (e *EnforcerImpl) counters() *enforcerCounters {
+	if counters, ok := e.stats.Load().(*enforcerCounters); ok {
+		return counters
+	}
+	e.stats.CompareAndSwap(nil, &enforcerCounters{})
+	return e.stats.Load().(*enforcerCounters)
+}
+
+// Stats returns a snapshot of the counters
+func (e *EnforcerImpl) Stats() EnforcerStats {
+	counters := e.counters()
+	stats := EnforcerStats{
+		CacheHits:         atomic.LoadInt64(&counters.cacheHits),
+		CacheMisses:       atomic.LoadInt64(&counters.cacheMisses),
+		LockContention:    atomic.LoadInt64(&counters.lockContention),
+		CacheTimeouts:     atomic.LoadInt64(&counters.cacheTimeouts),
+		TokenEnforcements: atomic.LoadInt64(&counters.tokenEnforcements),
+		VerifyDuration:    time.Duration(atomic.LoadInt64(&counters.verifyNanos)),
+		PolicyDuration:    time.Duration(atomic.LoadInt64(&counters.policyNanos)),
+	}
+	if durations, ok := counters.lastBatchDurations.Load().([]int64); ok {
+		stats.LastBatchDurationsInMs = append([]int64{}, durations...)
+	}
+	stats.BatchSizes = make([]BatchSizeBucket, len(counters.batchSizeCounts))
+	for i := range counters.batchSizeCounts {
+		stats.BatchSizes[i].Count = atomic.LoadInt64(&counters.batchSizeCounts[i])
+		if i < len(batchSizeBuckets) {
+			stats.BatchSizes[i].MaxSize = batchSizeBuckets[i]
+		}
+	}
+	return stats
+}
+
+// ResetStats clears the counters, cache contents are left untouched
+func (e *EnforcerImpl) ResetStats() {
+	e.stats.Store(&enforcerCounters{})
+}
+
+func (e *EnforcerImpl) recordCacheLookup(hits int, misses int) {
+	counters := e.counters()
+	atomic.AddInt64(&counters.cacheHits, int64(hits))
+	atomic.AddInt64(&counters.cacheMisses, int64(misses))
+}
+
+// recordBatchDurations keeps the per goroutine durations of a batch, metrics is indexed by goroutine
+func (e *EnforcerImpl) recordBatchDurations(metrics map[int]int64) {
+	durations := make([]int64, len(metrics))
+	for i := range durations {
+		durations[i] = metrics[i]
+	}
+	e.counters().lastBatchDurations.Store(durations)
+}
+
+// recordBatchSize counts a batch enforcement of size objects in its BatchSizes bucket
+func (e *EnforcerImpl) recordBatchSize(size int) {
+	bucket := sort.SearchInts(batchSizeBuckets[:], size)
+	atomic.AddInt64(&e.counters().batchSizeCounts[bucket], 1)
+}
+
+// recordTokenEnforcement adds the verification and policy evaluation durations of an Enforce call
+func (e *EnforcerImpl) recordTokenEnforcement(verify time.Duration, policy time.Duration) {
+	counters := e.counters()
+	atomic.AddInt64(&counters.tokenEnforcements, 1)
+	atomic.AddInt64(&counters.verifyNanos, int64(verify))
+	atomic.AddInt64(&counters.policyNanos, int64(policy))
+}
+
+// acquireCacheLock locks cacheMutex, counting the acquisitions which have to wait
+func (e *EnforcerImpl) acquireCacheLock(cacheMutex *cacheLock) {
+	if cacheMutex.TryLock() {
+		return
+	}
+	atomic.AddInt64(&e.counters().lockContention, 1)
+	cacheMutex.Lock()
+}
+
+// acquireCacheLockWithin is acquireCacheLock giving up after ENFORCER_CACHE_TIMEOUT_IN_MS, reporting whether
+// cacheMutex was locked
+func (e *EnforcerImpl) acquireCacheLockWithin(cacheMutex *cacheLock) bool {
+	timeout := time.Duration(e.config.CacheTimeoutInMs) * time.Millisecond
+	if timeout <= 0 {
+		e.acquireCacheLock(cacheMutex)
+		return true
+	}
+	if cacheMutex.TryLock() {
+		return true
+	}
+	atomic.AddInt64(&e.counters().lockContention, 1)
+	if cacheMutex.lockWithin(timeout) {
+		return true
+	}
+	atomic.AddInt64(&e.counters().cacheTimeouts, 1)
+	return false
+}
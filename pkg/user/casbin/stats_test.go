@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestStats(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	vals := []string{"team1/app1", "team2/app1", "team3/app1"}
+	enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals)
+	enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", append(vals, "team4/app1"))
+	if stats, want := enforcer.Stats(), (EnforcerStats{CacheHits: 3, CacheMisses: 4}); stats.CacheHits != want.CacheHits || stats.CacheMisses != want.CacheMisses {
+		t.Errorf("Stats() = %+v, want hits and misses of %+v", stats, want)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals)
+		}()
+	}
+	wg.Wait()
+
+	enforcer.ResetStats()
+	if stats, want := enforcer.Stats(), (&EnforcerImpl{}).Stats(); !reflect.DeepEqual(stats, want) {
+		t.Errorf("Stats() after reset = %+v, want zero %+v", stats, want)
+	}
+	if cached := getCacheData(enforcer, "user@example.com", "applications", "get"); len(cached) != 4 {
+		t.Errorf("cache size after reset = %d, want 4", len(cached))
+	}
+}
+
+func TestStatsEnforceDurations(t *testing.T) {
+	enf := newTestCasbinEnforcerWithModel(slowMatchModel, map[string]matcherFunc{"slowMatch": slowMatcher(5 * time.Millisecond)}, testPolicies, testGroupings)
+	enforcer := newTestEnforcerFor(t, false, enf)
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+	if !enforcer.Enforce(token, "applications", "get", "team1/app1") {
+		t.Fatalf("Enforce of allowed object denied")
+	}
+	stats := enforcer.Stats()
+	if stats.TokenEnforcements != 1 {
+		t.Errorf("TokenEnforcements = %d, want 1", stats.TokenEnforcements)
+	}
+	if stats.VerifyDuration <= 0 {
+		t.Errorf("VerifyDuration = %v, want nonzero", stats.VerifyDuration)
+	}
+	if stats.PolicyDuration < 5*time.Millisecond {
+		t.Errorf("PolicyDuration = %v, want at least the matcher delay", stats.PolicyDuration)
+	}
+	if stats.VerifyDuration >= stats.PolicyDuration {
+		t.Errorf("VerifyDuration %v not separated from PolicyDuration %v", stats.VerifyDuration, stats.PolicyDuration)
+	}
+}
+
+func TestStatsLastBatchDurations(t *testing.T) {
+	t.Setenv("ENFORCER_MAX_BATCH_SIZE", "4")
+	enforcer := newTestEnforcer(t, true, testPolicies, testGroupings)
+	tests := []struct {
+		name string
+		vals []string
+		want int
+	}{
+		{name: "more objects than batch size", vals: []string{"team1/a1", "team1/a2", "team1/a3", "team1/a4", "team1/a5", "team1/a6"}, want: 4},
+		{name: "fewer objects than batch size", vals: []string{"team2/a1", "team2/a2"}, want: 2},
+		{name: "single object", vals: []string{"team3/a1"}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", tt.vals)
+			if durations := enforcer.Stats().LastBatchDurationsInMs; len(durations) != tt.want {
+				t.Errorf("LastBatchDurationsInMs = %v, want %d durations", durations, tt.want)
+			}
+		})
+	}
+	enforcer.ResetStats()
+	if durations := enforcer.Stats().LastBatchDurationsInMs; durations != nil {
+		t.Errorf("LastBatchDurationsInMs after reset = %v, want none", durations)
+	}
+}
+
+func TestStatsBatchSizes(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	for _, size := range []int{1, 3, 4, 4, 64, 2000} {
+		vals := make([]string, size)
+		for i := range vals {
+			vals[i] = fmt.Sprintf("team1/app%d", i)
+		}
+		enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", vals)
+	}
+	enforcer.EnforceByEmailInBatch("user@example.com", "applications", "get", nil)
+
+	want := map[int]int64{1: 2, 4: 3, 64: 1, 0: 1}
+	buckets := enforcer.Stats().BatchSizes
+	if len(buckets) != len(batchSizeBuckets)+1 || buckets[len(buckets)-1].MaxSize != 0 {
+		t.Fatalf("BatchSizes = %+v, want a bucket per size and a last unbounded one", buckets)
+	}
+	for _, bucket := range buckets {
+		if bucket.Count != want[bucket.MaxSize] {
+			t.Errorf("count of batches up to %d objects = %d, want %d", bucket.MaxSize, bucket.Count, want[bucket.MaxSize])
+		}
+	}
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devtron-labs/authenticator/jwt"
+	jwt2 "github.com/golang-jwt/jwt/v4"
+	"github.com/patrickmn/go-cache"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTokenCache(config *EnforcerConfig) *cache.Cache {
+	if config.TokenCacheExpirationInSec <= 0 {
+		return nil
+	}
+	return cache.New(time.Duration(config.TokenCacheExpirationInSec)*time.Second, time.Minute)
+}
+
+// verifyToken verifies the token through the session manager and returns its claims. When the token cache is
+// enabled, verified claims are kept for ENFORCER_TOKEN_CACHE_EXPIRATION_IN_SEC but never beyond the token's own exp
+func (e *EnforcerImpl) verifyToken(token string) (jwt2.MapClaims, error) {
+	if e.tokenCache == nil {
+		return e.parseToken(token)
+	}
+	key := getTokenCacheKey(token)
+	if cached, found := e.tokenCache.Get(key); found {
+		mapClaims := cached.(jwt2.MapClaims)
+		if mapClaims.VerifyExpiresAt(time.Now().Unix(), false) {
+			return mapClaims, nil
+		}
+		e.tokenCache.Delete(key)
+	}
+	mapClaims, err := e.parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	expiration := time.Duration(e.config.TokenCacheExpirationInSec) * time.Second
+	if exp, ok := mapClaims["exp"].(float64); ok {
+		if untilExpiry := time.Until(time.Unix(int64(exp), 0)); untilExpiry < expiration {
+			expiration = untilExpiry
+		}
+	}
+	if expiration > 0 {
+		e.tokenCache.Set(key, mapClaims, expiration)
+	}
+	return mapClaims, nil
+}
+
+// getSubjectEmail returns the lower cased email the claims are enforced as, locally issued admin tokens carry no
+// email and are enforced as admin. It is empty for other tokens without an email
+func getSubjectEmail(mapClaims jwt2.MapClaims) string {
+	email := getClaimEmail(mapClaims)
+	if isSyntheticAdmin(mapClaims) {
+		email = adminSubject
+	}
+	return strings.ToLower(email)
+}
+
+// ResolveSubject returns the lower cased subject verified claims are enforced as under cfg, for packages resolving
+// subjects outside of an enforcer. Locally issued admin tokens without an email resolve to admin, nil claims to
+// cfg.AnonymousSubject when cfg.AllowAnonymous is set. It is empty for claims enforcement denies outright. The
+// resolver of EnforcerImpl.SetSubjectResolver is not applied
+func ResolveSubject(claims jwt2.Claims, cfg EnforcerConfig) string {
+	if claims == nil {
+		return getAnonymousSubject(&cfg)
+	}
+	mapClaims, ok := claims.(jwt2.MapClaims)
+	if !ok {
+		var err error
+		if mapClaims, err = jwt.MapClaims(claims); err != nil {
+			return ""
+		}
+	}
+	return getSubjectEmail(mapClaims)
+}
+
+// getAnonymousSubject returns the lower cased subject requests without a token are enforced as, empty unless
+// enabled by config
+func getAnonymousSubject(config *EnforcerConfig) string {
+	if !config.AllowAnonymous {
+		return ""
+	}
+	return strings.ToLower(config.AnonymousSubject)
+}
+
+// adminSubject is the subject locally issued admin tokens are enforced as
+const adminSubject = "admin"
+
+// getClaimEmail returns the email claim without surrounding spaces, some identity providers send a whitespace
+// email for users without one
+func getClaimEmail(mapClaims jwt2.MapClaims) string {
+	return strings.TrimSpace(jwt.GetField(mapClaims, "email"))
+}
+
+// isSyntheticAdmin tells whether the claims are of a locally issued admin token, which carries no email
+func isSyntheticAdmin(mapClaims jwt2.MapClaims) bool {
+	sub := jwt.GetField(mapClaims, "sub")
+	return getClaimEmail(mapClaims) == "" && (sub == "admin" || sub == "admin:login")
+}
+
+// warnIfAdminUngranted logs once when admin tokens are enforced as subject while no policy applies to it, such
+// tokens are denied everything unless subject is granted a role or ENFORCER_ADMIN_AUTO_GRANT is set
+func (e *EnforcerImpl) warnIfAdminUngranted(subject string) {
+	if atomic.LoadInt32(&e.adminUngrantedWarned) == 1 {
+		return
+	}
+	if len(e.Enforcer.GetFilteredPolicy(0, subject)) > 0 || len(e.Enforcer.GetImplicitRolesForUser(subject)) > 0 {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&e.adminUngrantedWarned, 0, 1) {
+		e.logger.Warnw("admin subject has no policies, admin tokens are denied, grant it a role or set ENFORCER_ADMIN_AUTO_GRANT",
+			"subject", subject)
+	}
+}
+
+// subjectResolver holds the function canonicalizing subjects resolved from tokens
+type subjectResolver struct {
+	mutex   sync.RWMutex
+	resolve func(raw string) string
+}
+
+// SetSubjectResolver sets resolver to map subjects resolved from tokens, e.g. a username, to the canonical subject
+// their policies are written for, e.g. the user's email. Subjects resolver returns empty for are kept as is, nil
+// removes the resolver. Cached decisions are dropped as they may be held under the previous subjects
+func (e *EnforcerImpl) SetSubjectResolver(resolver func(raw string) string) {
+	e.subjectResolver.mutex.Lock()
+	e.subjectResolver.resolve = resolver
+	e.subjectResolver.mutex.Unlock()
+	e.InvalidateCompleteCache()
+}
+
+// resolveSubject returns the lower cased canonical subject of the claims
+func (e *EnforcerImpl) resolveSubject(mapClaims jwt2.MapClaims) string {
+	subject := getSubjectEmail(mapClaims)
+	if subject == "" {
+		return ""
+	}
+	e.subjectResolver.mutex.RLock()
+	resolve := e.subjectResolver.resolve
+	e.subjectResolver.mutex.RUnlock()
+	if resolve == nil {
+		return subject
+	}
+	if canonical := resolve(subject); canonical != "" {
+		return strings.ToLower(canonical)
+	}
+	return subject
+}
+
+func (e *EnforcerImpl) parseToken(token string) (jwt2.MapClaims, error) {
+	claims, err := e.SessionManager.VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	mapClaims, err := jwt.MapClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkTokenClaims(mapClaims); err != nil {
+		return nil, err
+	}
+	return mapClaims, nil
+}
+
+// ErrTokenAudienceMismatch and ErrTokenIssuerMismatch are returned for verified tokens not issued for, or not by,
+// the expected parties, see EnforcerConfig.TokenAudience and EnforcerConfig.TokenIssuer
+var (
+	ErrTokenAudienceMismatch = status.Error(codes.Unauthenticated, "token audience does not match")
+	ErrTokenIssuerMismatch   = status.Error(codes.Unauthenticated, "token issuer does not match")
+)
+
+// checkTokenClaims validates the audience and issuer of verified claims against the configured ones, if any
+func (e *EnforcerImpl) checkTokenClaims(mapClaims jwt2.MapClaims) error {
+	if audience := e.config.TokenAudience; audience != "" && !mapClaims.VerifyAudience(audience, true) {
+		return ErrTokenAudienceMismatch
+	}
+	if issuer := e.config.TokenIssuer; issuer != "" && !mapClaims.VerifyIssuer(issuer, true) {
+		return ErrTokenIssuerMismatch
+	}
+	return nil
+}
+
+// unauthenticatedErr converts an error of verifyToken to codes.Unauthenticated, keeping the audience and issuer
+// mismatch errors distinguishable
+func unauthenticatedErr(err error) error {
+	if err == ErrTokenAudienceMismatch || err == ErrTokenIssuerMismatch {
+		return err
+	}
+	return status.Error(codes.Unauthenticated, err.Error())
+}
+
+// bearerPrefix precedes the token in Authorization headers, matched case insensitively
+const bearerPrefix = "bearer "
+
+// EnforceAuthHeader is Enforce for the value of an Authorization header, "Bearer <token>", rvals being the
+// resource, action and object. Headers which are empty or don't carry a bearer token are denied, including when
+// ENFORCER_ALLOW_ANONYMOUS is set
+func (e *EnforcerImpl) EnforceAuthHeader(header string, rvals ...interface{}) bool {
+	token, ok := getBearerToken(header)
+	if !ok {
+		return false
+	}
+	return e.Enforce(append([]interface{}{token}, rvals...)...)
+}
+
+// getBearerToken returns the token of an Authorization header, false when it carries none
+func getBearerToken(header string) (string, bool) {
+	header = strings.TrimSpace(header)
+	if len(header) <= len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(header[len(bearerPrefix):])
+	return token, token != ""
+}
+
+// getTokenCacheKey hashes the token so that raw tokens are never held as cache keys
+func getTokenCacheKey(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
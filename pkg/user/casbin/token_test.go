@@ -0,0 +1,343 @@
+/*
+ * Copyright (c) 2020 Devtron Labs
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package casbin
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devtron-labs/authenticator/middleware"
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTokenCacheDoesNotServeExpiredToken(t *testing.T) {
+	t.Setenv("ENFORCER_TOKEN_CACHE_EXPIRATION_IN_SEC", "60")
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	exp := time.Now().Add(time.Second).Unix()
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com", "exp": exp})
+	if !enforcer.Enforce(token, "applications", "get", "team1/app1") {
+		t.Fatalf("Enforce() = false before token expiry, want true")
+	}
+	if _, found := enforcer.tokenCache.Get(getTokenCacheKey(token)); !found {
+		t.Fatalf("verified claims not cached")
+	}
+	time.Sleep(time.Until(time.Unix(exp+1, 0)))
+	if enforcer.Enforce(token, "applications", "get", "team1/app1") {
+		t.Errorf("Enforce() = true for expired token, want false")
+	}
+}
+
+func TestTokenCacheDisabledByDefault(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+	if !enforcer.Enforce(token, "applications", "get", "team1/app1") {
+		t.Errorf("Enforce() = false, want true")
+	}
+	if enforcer.tokenCache != nil {
+		t.Errorf("token cache enabled without ENFORCER_TOKEN_CACHE_EXPIRATION_IN_SEC")
+	}
+}
+
+func BenchmarkEnforceTokenCache(b *testing.B) {
+	for _, expiration := range []string{"0", "60"} {
+		b.Run("expiration-"+expiration, func(b *testing.B) {
+			b.Setenv("ENFORCER_TOKEN_CACHE_EXPIRATION_IN_SEC", expiration)
+			b.Setenv("ENFORCER_CACHE", "false")
+			enforcer := NewEnforcerImpl(newTestCasbinEnforcer(testPolicies, testGroupings), testSessionManager, nopLogger)
+			token := newTestToken(b, jwt.MapClaims{"email": "user@example.com", "exp": time.Now().Add(time.Hour).Unix()})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				enforcer.Enforce(token, "applications", "get", "team1/app1")
+			}
+		})
+	}
+}
+
+func TestEnforceAuthErr(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	validToken := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+	expiredToken := newTestToken(t, jwt.MapClaims{"email": "user@example.com", "exp": time.Now().Add(-time.Minute).Unix()})
+	tests := []struct {
+		name   string
+		token  string
+		object string
+		want   codes.Code
+	}{
+		{name: "allowed", token: validToken, object: "team1/app1", want: codes.OK},
+		{name: "denied by policy", token: validToken, object: "team9/app1", want: codes.PermissionDenied},
+		{name: "expired token", token: expiredToken, object: "team1/app1", want: codes.Unauthenticated},
+		{name: "malformed token", token: "not-a-token", object: "team1/app1", want: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := enforcer.EnforceAuthErr(tt.token, "applications", "get", tt.object)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("EnforceAuthErr() code = %v, want %v", got, tt.want)
+			}
+			if denied := errors.Is(err, ErrPermissionDenied); denied != (tt.want == codes.PermissionDenied) {
+				t.Errorf("errors.Is(EnforceAuthErr(), ErrPermissionDenied) = %v for code %v", denied, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnforceErrPermissionDenied(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+	err := enforcer.EnforceErr(token, "applications", "get", "team9/app1")
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("errors.Is(EnforceErr(), ErrPermissionDenied) = false for %v", err)
+	}
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("EnforceErr() code = %v, want %v", status.Code(err), codes.PermissionDenied)
+	}
+	if want := "rpc error: code = PermissionDenied desc = permission denied: applications, get, team9/app1"; err.Error() != want {
+		t.Errorf("EnforceErr() message = %q, want %q", err.Error(), want)
+	}
+	if err := enforcer.EnforceErr(token, "applications", "get", "team1/app1"); err != nil {
+		t.Errorf("EnforceErr() of allowed object = %v, want nil", err)
+	}
+}
+
+func TestEnforceResolve(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, append(testPolicies,
+		[]string{"admin", "applications", "get", "*", "allow"},
+	), testGroupings)
+	tests := []struct {
+		name        string
+		token       string
+		wantAllowed bool
+		wantSubject string
+		wantErr     codes.Code
+	}{
+		{name: "email claim", token: newTestToken(t, jwt.MapClaims{"email": "User@Example.com"}), wantAllowed: true, wantSubject: "user@example.com"},
+		{name: "denied", token: newTestToken(t, jwt.MapClaims{"email": "other@example.com"}), wantSubject: "other@example.com"},
+		{name: "admin fallback", token: newTestToken(t, jwt.MapClaims{"sub": "admin"}), wantAllowed: true, wantSubject: "admin"},
+		{name: "invalid token", token: "not-a-token", wantErr: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, subject, err := enforcer.EnforceResolve(tt.token, "applications", "get", "team1/app1")
+			if allowed != tt.wantAllowed || subject != tt.wantSubject || status.Code(err) != tt.wantErr {
+				t.Errorf("EnforceResolve() = %v, %q, %v, want %v, %q, %v", allowed, subject, err, tt.wantAllowed, tt.wantSubject, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSubjectResolver(t *testing.T) {
+	enforcer := newTestEnforcer(t, true, [][]string{
+		{"alice@corp.com", "applications", "get", "team1/*", "allow"},
+	}, nil)
+	emailToken := newTestToken(t, jwt.MapClaims{"email": "alice@corp.com"})
+	usernameToken := newTestToken(t, jwt.MapClaims{"email": "Alice"})
+	if enforcer.Enforce(usernameToken, "applications", "get", "team1/app1") {
+		t.Fatalf("Enforce() of alias allowed without a resolver")
+	}
+
+	aliases := map[string]string{"alice": "Alice@corp.com"}
+	enforcer.SetSubjectResolver(func(raw string) string {
+		return aliases[raw]
+	})
+	for name, token := range map[string]string{"email": emailToken, "alias": usernameToken} {
+		allowed, subject, err := enforcer.EnforceResolve(token, "applications", "get", "team1/app1")
+		if !allowed || subject != "alice@corp.com" || err != nil {
+			t.Errorf("EnforceResolve() of %s = %v, %q, %v, want true, %q", name, allowed, subject, err, "alice@corp.com")
+		}
+	}
+	if enforcer.Enforce(usernameToken, "applications", "get", "team2/app1") {
+		t.Errorf("Enforce() of alias allowed object not granted to the canonical subject")
+	}
+}
+
+func TestAdminSubjectWithoutPolicy(t *testing.T) {
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	recorder, logger := newLogRecorder()
+	enforcer.logger = logger
+	token := newTestToken(t, jwt.MapClaims{"sub": "admin"})
+	for i := 0; i < 2; i++ {
+		if enforcer.Enforce(token, "applications", "get", "team1/app1") {
+			t.Errorf("Enforce() of admin without admin policy allowed")
+		}
+	}
+	if count := recorder.count("admin subject has no policies, admin tokens are denied, grant it a role or set ENFORCER_ADMIN_AUTO_GRANT"); count != 1 {
+		t.Errorf("admin without policies warned %d times, want once", count)
+	}
+
+	userToken := newTestToken(t, jwt.MapClaims{"email": "admin", "sub": "someone"})
+	t.Setenv("ENFORCER_ADMIN_AUTO_GRANT", "true")
+	granting := newTestEnforcer(t, false, testPolicies, testGroupings)
+	if allowed, subject, err := granting.EnforceResolve(token, "applications", "delete", "team9/app1"); !allowed || subject != "admin" || err != nil {
+		t.Errorf("EnforceResolve() of admin with auto grant = %v, %q, %v, want allowed as admin", allowed, subject, err)
+	}
+	if granting.Enforce(userToken, "applications", "delete", "team9/app1") {
+		t.Errorf("Enforce() of a token with an admin email claim auto granted, want only locally issued admin tokens")
+	}
+}
+
+func TestWhitespaceEmailClaim(t *testing.T) {
+	t.Setenv("ENFORCER_ADMIN_AUTO_GRANT", "true")
+	enforcer := newTestEnforcer(t, false, testPolicies, append([][]string{{"", "role:team3-admin"}}, testGroupings...))
+	tests := []struct {
+		name        string
+		claims      jwt.MapClaims
+		wantAllowed bool
+		wantSubject string
+	}{
+		{name: "spaces around email", claims: jwt.MapClaims{"email": "  User@example.com\t", "sub": "someone"}, wantAllowed: true, wantSubject: "user@example.com"},
+		{name: "whitespace email of admin", claims: jwt.MapClaims{"email": "  ", "sub": "admin"}, wantAllowed: true, wantSubject: "admin"},
+		{name: "whitespace email", claims: jwt.MapClaims{"email": " \t ", "sub": "someone"}, wantAllowed: false, wantSubject: ""},
+		{name: "empty email", claims: jwt.MapClaims{"email": "", "sub": "someone"}, wantAllowed: false, wantSubject: ""},
+		{name: "no email", claims: jwt.MapClaims{"sub": "someone"}, wantAllowed: false, wantSubject: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := newTestToken(t, tt.claims)
+			allowed, subject, err := enforcer.EnforceResolve(token, "applications", "get", "team3/app1")
+			if allowed != tt.wantAllowed || subject != tt.wantSubject || err != nil {
+				t.Errorf("EnforceResolve() = %v, %q, %v, want %v, %q", allowed, subject, err, tt.wantAllowed, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestEnforceAnonymous(t *testing.T) {
+	policies := append([][]string{{"anonymous", "applications", "get", "public/*", "allow"}}, testPolicies...)
+	denying := newTestEnforcer(t, false, policies, testGroupings)
+	if allowed, _, err := denying.EnforceResolve("", "applications", "get", "public/app1"); allowed || status.Code(err) != codes.Unauthenticated {
+		t.Errorf("EnforceResolve() without token = %v, %v, want unauthenticated", allowed, err)
+	}
+
+	t.Setenv("ENFORCER_ALLOW_ANONYMOUS", "true")
+	enforcer := newTestEnforcer(t, false, policies, testGroupings)
+	if allowed, subject, err := enforcer.EnforceResolve("", "applications", "get", "public/app1"); !allowed || subject != "anonymous" || err != nil {
+		t.Errorf("EnforceResolve() without token = %v, %q, %v, want allowed as anonymous", allowed, subject, err)
+	}
+	if enforcer.Enforce("", "applications", "get", "team1/app1") {
+		t.Errorf("Enforce() without token allowed an object not granted to anonymous")
+	}
+	if _, _, err := enforcer.EnforceResolve("invalid", "applications", "get", "public/app1"); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("EnforceResolve() of an invalid token = %v, want unauthenticated", err)
+	}
+
+	t.Setenv("ENFORCER_ANONYMOUS_SUBJECT", "")
+	if newTestEnforcer(t, false, policies, testGroupings).Enforce("", "applications", "get", "public/app1") {
+		t.Errorf("Enforce() without token and anonymous subject allowed")
+	}
+}
+
+func TestTokenAudienceAndIssuer(t *testing.T) {
+	t.Setenv("ENFORCER_TOKEN_AUDIENCE", "devtron")
+	enforcer := newTestEnforcer(t, false, testPolicies, testGroupings)
+	tests := []struct {
+		name        string
+		claims      jwt.MapClaims
+		wantAllowed bool
+		wantErr     error
+	}{
+		{name: "matching audience", claims: jwt.MapClaims{"email": "user@example.com", "aud": "devtron"}, wantAllowed: true},
+		{name: "matching audience in list", claims: jwt.MapClaims{"email": "user@example.com", "aud": []string{"other", "devtron"}}, wantAllowed: true},
+		{name: "mismatching audience", claims: jwt.MapClaims{"email": "user@example.com", "aud": "other"}, wantErr: ErrTokenAudienceMismatch},
+		{name: "no audience", claims: jwt.MapClaims{"email": "user@example.com"}, wantErr: ErrTokenAudienceMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := newTestToken(t, tt.claims)
+			allowed, _, err := enforcer.EnforceResolve(token, "applications", "get", "team1/app1")
+			if allowed != tt.wantAllowed || err != tt.wantErr {
+				t.Errorf("EnforceResolve() = %v, %v, want %v, %v", allowed, err, tt.wantAllowed, tt.wantErr)
+			}
+			if enforcer.Enforce(token, "applications", "get", "team1/app1") != tt.wantAllowed {
+				t.Errorf("Enforce() = %v, want %v", !tt.wantAllowed, tt.wantAllowed)
+			}
+		})
+	}
+
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com", "aud": "devtron"})
+	t.Setenv("ENFORCER_TOKEN_ISSUER", middleware.SessionManagerClaimsIssuer)
+	if allowed, _, err := newTestEnforcer(t, false, testPolicies, testGroupings).EnforceResolve(token, "applications", "get", "team1/app1"); !allowed || err != nil {
+		t.Errorf("EnforceResolve() of matching issuer = %v, %v, want allowed", allowed, err)
+	}
+	t.Setenv("ENFORCER_TOKEN_ISSUER", "other")
+	if allowed, _, err := newTestEnforcer(t, false, testPolicies, testGroupings).EnforceResolve(token, "applications", "get", "team1/app1"); allowed || err != ErrTokenIssuerMismatch {
+		t.Errorf("EnforceResolve() of mismatching issuer = %v, %v, want %v", allowed, err, ErrTokenIssuerMismatch)
+	}
+	if status.Code(ErrTokenAudienceMismatch) != codes.Unauthenticated || status.Code(ErrTokenIssuerMismatch) != codes.Unauthenticated {
+		t.Errorf("mismatch errors are not unauthenticated")
+	}
+}
+
+func TestResolveSubject(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.Claims
+		cfg    EnforcerConfig
+		want   string
+	}{
+		{name: "email present", claims: jwt.MapClaims{"email": " User@Example.com ", "sub": "someone"}, want: "user@example.com"},
+		{name: "email present with admin sub", claims: jwt.MapClaims{"email": "user@example.com", "sub": "admin"}, want: "user@example.com"},
+		{name: "empty email with admin sub", claims: jwt.MapClaims{"email": "", "sub": "admin"}, want: "admin"},
+		{name: "empty email with admin login sub", claims: jwt.MapClaims{"sub": "admin:login"}, want: "admin"},
+		{name: "empty email without admin sub", claims: jwt.MapClaims{"email": " ", "sub": "someone"}, want: ""},
+		{name: "registered claims of admin", claims: &jwt.RegisteredClaims{Subject: "admin"}, want: "admin"},
+		{name: "no claims", want: ""},
+		{name: "no claims with anonymous", cfg: EnforcerConfig{AllowAnonymous: true, AnonymousSubject: "Anonymous"}, want: "anonymous"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveSubject(tt.claims, tt.cfg); got != tt.want {
+				t.Errorf("ResolveSubject() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnforceAuthHeader(t *testing.T) {
+	t.Setenv("ENFORCER_ALLOW_ANONYMOUS", "true")
+	policies := append([][]string{{"anonymous", "applications", "get", "team1/*", "allow"}}, testPolicies...)
+	enforcer := newTestEnforcer(t, false, policies, testGroupings)
+	token := newTestToken(t, jwt.MapClaims{"email": "user@example.com"})
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "Bearer prefix", header: "Bearer " + token, want: true},
+		{name: "bearer prefix", header: "bearer " + token, want: true},
+		{name: "BEARER prefix with spaces", header: "  BEARER   " + token + " ", want: true},
+		{name: "empty header", header: ""},
+		{name: "prefix only", header: "Bearer "},
+		{name: "prefix without space", header: "Bearer" + token},
+		{name: "token without prefix", header: token},
+		{name: "basic credentials", header: "Basic dXNlcjpwYXNz"},
+		{name: "invalid token", header: "Bearer invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := enforcer.EnforceAuthHeader(tt.header, "applications", "get", "team1/app1"); got != tt.want {
+				t.Errorf("EnforceAuthHeader(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+	if enforcer.EnforceAuthHeader("Bearer "+token, "applications", "get", "team9/app1") {
+		t.Errorf("EnforceAuthHeader() allowed an object not granted")
+	}
+}